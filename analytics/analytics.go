@@ -1,2 +1,517 @@
 // Package analytics help us track events to business people.
 package analytics
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/dukex/mixpanel"
+	"github.com/facily-tech/go-core/env"
+	"github.com/facily-tech/go-core/log"
+	"github.com/gammazero/workerpool"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	prefix   = "ANALYTICS_"
+	poolSize = 5
+)
+
+type config struct {
+	Token         string `env:"MIXPANEL_TOKEN"`
+	Secret        string `env:"MIXPANEL_SECRET"`
+	SpoolDir      string `env:"SPOOL_DIR"`
+	SpoolMaxBytes int64  `env:"SPOOL_MAX_BYTES"`
+}
+
+// Analytics track events and deliver them to Sink.
+type Analytics struct {
+	Sink   Sink
+	Logger log.Logger
+	// MixpanelEvent is the client of Sink when it is a MixpanelSink, replacing
+	// it makes events go through the new client.
+	//
+	// Deprecated: use WithSink or WithMixpanelURL.
+	MixpanelEvent mixpanel.Mixpanel
+	// mixpanelClient is MixpanelEvent as set by New or WithMixpanelURL.
+	mixpanelClient mixpanel.Mixpanel
+
+	wp          workerPool
+	batcher     *batcher
+	spool       *spool
+	retryPolicy RetryPolicy
+	deadLetter  DeadLetterFunc
+	enrichers   []Enricher
+	registry    *Registry
+	validation  ValidationMode
+	sanitizer   *SanitizePolicy
+	samplers    map[string]*sampler
+	maxQueue    int
+}
+
+type workerPool interface {
+	StopWait()
+	Submit(func())
+	WaitingQueueSize() int
+}
+
+// syncPool run tasks at the caller goroutine.
+type syncPool struct{}
+
+func (syncPool) StopWait() {}
+
+func (syncPool) Submit(task func()) { task() }
+
+func (syncPool) WaitingQueueSize() int { return 0 }
+
+var (
+	// DefaultAnalytics is used by package level functions, it's configured
+	// from environment at first use, see Default. Set it before first use to
+	// replace it.
+	DefaultAnalytics = &Analytics{} //nolint:exhaustruct // configured by Default.
+
+	// defaultInstance is the DefaultAnalytics created by this package, the only
+	// one configured from environment.
+	defaultInstance = DefaultAnalytics
+	defaultOnce     sync.Once
+	defaultErr      error
+
+	// ErrUnexpctedType error when we can't cast/type assert interface to (T).
+	ErrUnexpctedType = errors.New("cannot cast to desired type")
+	// ErrEmptyToken error when token is empty.
+	ErrEmptyToken = errors.New("token cannot by empty, use WithMixpanelURL")
+	// ErrNoSink error when there is no sink to deliver events.
+	ErrNoSink = errors.New("sink cannot be nil, use WithSink or WithMixpanelURL")
+)
+
+// Option configure Analytics created by New.
+type Option func(*options)
+
+type options struct {
+	token    string
+	secret   string
+	url      string
+	logger   log.Logger
+	poolSize int
+	sync     bool
+	sink     Sink
+}
+
+// OptionToken set mixpanel token, ignored if OptionSink is used.
+func OptionToken(token string) Option {
+	return func(o *options) {
+		o.token = token
+	}
+}
+
+// OptionSecret set mixpanel secret required by batching, ignored if
+// OptionSink is used.
+func OptionSecret(secret string) Option {
+	return func(o *options) {
+		o.secret = secret
+	}
+}
+
+// OptionURL set mixpanel api url, default "https://api.mixpanel.com", ignored
+// if OptionSink is used.
+func OptionURL(url string) Option {
+	return func(o *options) {
+		o.url = url
+	}
+}
+
+// OptionLogger set logger, default is a zap logger.
+func OptionLogger(logger log.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// OptionPoolSize set how many workers deliver events, default 5.
+func OptionPoolSize(size int) Option {
+	return func(o *options) {
+		o.poolSize = size
+	}
+}
+
+// OptionSynchronous deliver events at the caller goroutine instead of a
+// worker pool, Track returns after delivery. Useful at tests.
+func OptionSynchronous() Option {
+	return func(o *options) {
+		o.sync = true
+	}
+}
+
+// OptionSink set where events are delivered, default is mixpanel using
+// OptionToken, OptionSecret and OptionURL.
+func OptionSink(sink Sink) Option {
+	return func(o *options) {
+		o.sink = sink
+	}
+}
+
+// New creates an Analytics, call Close to flush events and stop its workers.
+func New(opts ...Option) (*Analytics, error) {
+	a := &Analytics{} //nolint:exhaustruct // configured by setup.
+	if err := a.setup(opts...); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// setup fills Logger, Sink and worker pool using opts, fields already set are
+// kept.
+func (a *Analytics) setup(opts ...Option) error {
+	o := options{poolSize: poolSize}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if a.Logger == nil {
+		if o.logger == nil {
+			logger, err := log.NewLoggerZap(log.ZapConfig{})
+			if err != nil {
+				return errors.Wrap(err, "cannot create analytics logger")
+			}
+			o.logger = logger
+		}
+		a.Logger = o.logger
+	}
+
+	if a.Sink == nil {
+		if o.sink == nil {
+			o.sink = NewMixpanelSinkWithSecret(o.token, o.secret, o.url)
+		}
+		a.Sink = o.sink
+
+		if m, ok := o.sink.(*MixpanelSink); ok {
+			// a MixpanelEvent set before keeps replacing the client.
+			if a.MixpanelEvent == nil {
+				a.MixpanelEvent = m.Client
+			}
+			a.mixpanelClient = m.Client
+		}
+	}
+
+	if a.wp == nil {
+		a.wp = syncPool{}
+		if !o.sync {
+			a.wp = workerpool.New(o.poolSize)
+		}
+	}
+
+	return nil
+}
+
+// NewFromEnv creates an Analytics using ANALYTICS_ environment variables,
+// opts override them. Spool is enabled if ANALYTICS_SPOOL_DIR is set.
+func NewFromEnv(ctx context.Context, opts ...Option) (*Analytics, error) {
+	a := &Analytics{} //nolint:exhaustruct // configured by setupFromEnv.
+	if err := a.setupFromEnv(ctx, opts...); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// setupFromEnv is setup using environment, see NewFromEnv.
+func (a *Analytics) setupFromEnv(ctx context.Context, opts ...Option) error {
+	var c config
+	if err := env.LoadEnv(ctx, &c, prefix); err != nil {
+		return errors.Wrap(err, "cannot load analytics config")
+	}
+
+	if err := a.setup(append([]Option{OptionToken(c.Token), OptionSecret(c.Secret)}, opts...)...); err != nil {
+		return err
+	}
+
+	if c.SpoolDir != "" && a.spool == nil {
+		if err := a.withSpool(SpoolConfig{Dir: c.SpoolDir, MaxBytes: c.SpoolMaxBytes}); err != nil {
+			a.Close()
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Default returns DefaultAnalytics, configuring it with environment, like
+// NewFromEnv, at first call unless it was replaced. Fields set before, like
+// using DefaultAnalytics.WithLogger, are kept. It panics if environment is
+// invalid.
+func Default() *Analytics {
+	defaultOnce.Do(func() {
+		if DefaultAnalytics == defaultInstance {
+			defaultErr = defaultInstance.setupFromEnv(context.Background())
+		}
+	})
+	if defaultErr != nil {
+		panic(defaultErr)
+	}
+
+	return DefaultAnalytics
+}
+
+// initDefault configures a if it's the DefaultAnalytics created by this
+// package, so its methods can be called before package level functions.
+func (a *Analytics) initDefault() {
+	if a == defaultInstance {
+		Default()
+	}
+}
+
+// WithWorkerPool stop current work pool if already running and creates
+// a new one with size workers.
+
+// WithWorkerPool is a wrapper around DefaultClient.WithWorkerPool.
+func WithWorkerPool(size int) {
+	Default().WithWorkerPool(size)
+}
+
+// WithWorkerPool stop current work pool if already running and creates
+// a new one with size workers.
+func (a *Analytics) WithWorkerPool(size int) {
+	if a.wp != nil {
+		a.wp.StopWait()
+	}
+	a.wp = workerpool.New(size)
+}
+
+// WithLogger change current log.Logger to externalLogger.
+
+// WithLogger is a wrapper around DefaultClient.WithLogger.
+func WithLogger(externalLogger log.Logger) {
+	Default().WithLogger(externalLogger)
+}
+
+// WithLogger change current log.Logger to externalLogger.
+func (a *Analytics) WithLogger(externalLogger log.Logger) {
+	a.Logger = externalLogger
+}
+
+// WithMixpanelURL client token and url. url can be empty and will default to
+// "https://api.mixpanel.com".
+
+// WithMixpanelURL is a wrapper around DefaultClient.WithMixpanelURL.
+func WithMixpanelURL(token, url string) {
+	Default().WithMixpanelURL(token, url)
+}
+
+// WithMixpanelURL client token and url. url can be empty and will default to
+// "https://api.mixpanel.com".
+func (a *Analytics) WithMixpanelURL(token, url string) {
+	sink := NewMixpanelSink(token, url)
+	a.Sink = sink
+	a.MixpanelEvent = sink.Client
+	a.mixpanelClient = sink.Client
+}
+
+// WithSink change where events are delivered, use FanOutSink to deliver to
+// more than one backend.
+
+// WithSink is a wrapper around DefaultClient.WithSink.
+func WithSink(sink Sink) {
+	Default().WithSink(sink)
+}
+
+// WithSink change where events are delivered, use FanOutSink to deliver to
+// more than one backend.
+func (a *Analytics) WithSink(sink Sink) {
+	a.Sink = sink
+}
+
+// Track queue an eventName with the following properties to be sent.
+func (a *Analytics) Track(eventName string, properties map[string]interface{}) {
+	a.TrackContext(context.Background(), eventName, properties)
+}
+
+// Track queue an eventName with the following properties to be sent.
+
+// Track is a wrapper around DefaultClient.Track.
+func Track(eventName string, properties map[string]interface{}) {
+	Default().Track(eventName, properties)
+}
+
+// TrackContext queue an eventName with the following properties to be sent,
+// properties and distinctId are enriched using ctx, see WithEnrichers. ctx is
+// only used for enrichment, cancelling it do not prevent delivery.
+func (a *Analytics) TrackContext(ctx context.Context, eventName string, properties map[string]interface{}) {
+	a.initDefault()
+
+	event, err := a.newEvent(ctx, eventName, properties)
+	if err != nil {
+		a.Logger.Error(ctx, "Error creating event", log.Error(err))
+
+		return
+	}
+	if !a.sample(&event) {
+		return
+	}
+
+	if a.spool != nil {
+		err := a.spool.write(event)
+		if err == nil {
+			return
+		}
+		a.Logger.Error(ctx, "Error writing event to spool, sending it directly", log.Error(err))
+	}
+
+	if a.batcher != nil {
+		a.batcher.add(event)
+
+		return
+	}
+
+	if a.queueFull() {
+		a.toDeadLetter(errors.WithStack(ErrQueueFull), event)
+
+		return
+	}
+
+	a.wp.Submit(func() {
+		if err := a.deliver(context.Background(), event); err != nil {
+			a.Logger.Error(context.Background(), "Error sending event to sink", log.Error(err))
+			a.toDeadLetter(err, event)
+		}
+	})
+}
+
+// TrackContext queue an eventName with the following properties to be sent,
+// properties and distinctId are enriched using ctx, see WithEnrichers.
+
+// TrackContext is a wrapper around DefaultClient.TrackContext.
+func TrackContext(ctx context.Context, eventName string, properties map[string]interface{}) {
+	Default().TrackContext(ctx, eventName, properties)
+}
+
+// TrackSync send an eventName with the following properties.
+
+// TrackSync is a wrapper around DefaultClient.TrackSync.
+func TrackSync(eventName string, properties map[string]interface{}) error {
+	return Default().TrackSync(eventName, properties)
+}
+
+// TrackSync send an eventName with the following properties.
+func (a *Analytics) TrackSync(eventName string, properties map[string]interface{}) error {
+	return a.TrackSyncContext(context.Background(), eventName, properties)
+}
+
+// TrackSyncContext send an eventName with the following properties enriched
+// using ctx, see WithEnrichers.
+
+// TrackSyncContext is a wrapper around DefaultClient.TrackSyncContext.
+func TrackSyncContext(ctx context.Context, eventName string, properties map[string]interface{}) error {
+	return Default().TrackSyncContext(ctx, eventName, properties)
+}
+
+// TrackSyncContext send an eventName with the following properties enriched
+// using ctx, see WithEnrichers.
+func (a *Analytics) TrackSyncContext(ctx context.Context, eventName string, properties map[string]interface{}) error {
+	a.initDefault()
+
+	event, err := a.newEvent(ctx, eventName, properties)
+	if err != nil {
+		return err
+	}
+	if !a.sample(&event) {
+		return nil
+	}
+
+	return a.deliver(ctx, event)
+}
+
+func (a *Analytics) send(ctx context.Context, event Event) error {
+	sink := a.sink()
+	if sink == nil {
+		return errors.WithStack(ErrNoSink)
+	}
+
+	return sink.Send(ctx, event)
+}
+
+// sink returns Sink, using MixpanelEvent as its client if it was replaced.
+func (a *Analytics) sink() Sink {
+	m, ok := a.Sink.(*MixpanelSink)
+	if !ok || a.MixpanelEvent == nil || sameClient(a.MixpanelEvent, a.mixpanelClient) {
+		return a.Sink
+	}
+
+	replaced := *m
+	replaced.Client = a.MixpanelEvent
+
+	return &replaced
+}
+
+// sameClient compares clients without panicking on uncomparable types.
+func sameClient(x, y mixpanel.Mixpanel) bool {
+	if x == nil || y == nil || reflect.TypeOf(x) != reflect.TypeOf(y) || !reflect.TypeOf(x).Comparable() {
+		return x == nil && y == nil
+	}
+
+	return x == y
+}
+
+// newEvent creates an Event using distinctId property as DistinctID, if it's
+// not present enrichers may set it, otherwise a random one is used.
+func (a *Analytics) newEvent(ctx context.Context, eventName string, properties map[string]interface{}) (Event, error) {
+	event := Event{
+		Name:       eventName,
+		DistinctID: "",
+		Timestamp:  time.Now(),
+		Properties: make(map[string]interface{}, len(properties)),
+		InsertID:   uuid.NewString(),
+	}
+	for k, v := range properties {
+		event.Properties[k] = v
+	}
+
+	if properties["distinctId"] != nil {
+		d, ok := properties["distinctId"].(string)
+		if !ok {
+			return Event{}, errors.Wrap(ErrUnexpctedType, "distinctId is not a string")
+		}
+		event.DistinctID = d
+	}
+
+	// enrichers may fill properties required by the schema.
+	a.enrich(ctx, &event)
+	if err := a.validate(&event); err != nil {
+		return Event{}, err
+	}
+
+	event.Properties = a.sanitize(event.Properties)
+	event.DistinctID = a.sanitizeID(event.DistinctID)
+
+	if event.DistinctID == "" {
+		event.DistinctID = uuid.NewString()
+	}
+
+	return event, nil
+}
+
+// Close flush buffered events, wait for events to be sent and stop worker pool.
+func (a *Analytics) Close() {
+	if a.spool != nil {
+		a.spool.close()
+		a.spool = nil
+	}
+	if a.batcher != nil {
+		a.batcher.close()
+	}
+	if a.wp != nil {
+		a.wp.StopWait()
+	}
+}
+
+// Close flush buffered events, wait for events to be sent and stop worker pool.
+
+// Close is a wrapper around DefaultClient.Close, nothing is done if
+// DefaultAnalytics was never used.
+func Close() {
+	DefaultAnalytics.Close()
+}
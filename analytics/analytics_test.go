@@ -0,0 +1,139 @@
+package analytics
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/facily-tech/go-core/log"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	t.Run("default options", func(t *testing.T) {
+		a, err := New()
+		assert.NoError(t, err)
+		defer a.Close()
+
+		assert.NotNil(t, a.Logger)
+		assert.IsType(t, &MixpanelSink{}, a.Sink)
+	})
+	t.Run("mixpanel options", func(t *testing.T) {
+		a, err := New(OptionToken("token"), OptionSecret("secret"), OptionURL("http://localhost"))
+		assert.NoError(t, err)
+		defer a.Close()
+
+		sink, ok := a.Sink.(*MixpanelSink)
+		assert.True(t, ok)
+		assert.Equal(t, "token", sink.token)
+		assert.Equal(t, "secret", sink.secret)
+		assert.Equal(t, "http://localhost", sink.url)
+	})
+	t.Run("custom sink and logger", func(t *testing.T) {
+		var got Event
+		logger := log.NewMockLogger(gomock.NewController(t))
+		sink := sinkFunc(func(ctx context.Context, event Event) error {
+			got = event
+
+			return nil
+		})
+
+		a, err := New(OptionSink(sink), OptionLogger(logger), OptionPoolSize(1))
+		assert.NoError(t, err)
+
+		a.Track("eventName", nil)
+		a.Close()
+
+		assert.Equal(t, logger, a.Logger)
+		assert.Equal(t, "eventName", got.Name)
+		assert.NotEmpty(t, got.InsertID)
+	})
+}
+
+func TestNewFromEnv(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		t.Setenv("ANALYTICS_MIXPANEL_TOKEN", "token")
+		t.Setenv("ANALYTICS_SPOOL_DIR", t.TempDir())
+
+		a, err := NewFromEnv(context.Background(), OptionSecret("secret"))
+		assert.NoError(t, err)
+
+		sink, ok := a.Sink.(*MixpanelSink)
+		assert.True(t, ok)
+		assert.Equal(t, "token", sink.token)
+		assert.Equal(t, "secret", sink.secret)
+		assert.NotNil(t, a.spool)
+
+		a.Close()
+		assert.Nil(t, a.spool)
+	})
+	t.Run("invalid env", func(t *testing.T) {
+		t.Setenv("ANALYTICS_SPOOL_MAX_BYTES", "not a number")
+
+		_, err := NewFromEnv(context.Background())
+		assert.Error(t, err)
+	})
+}
+
+func TestDefault(t *testing.T) {
+	reset := func() {
+		//nolint:exhaustruct // accept default values at structs
+		DefaultAnalytics = &Analytics{}
+		defaultInstance = DefaultAnalytics
+		defaultOnce = sync.Once{}
+		defaultErr = nil
+	}
+	defer reset()
+
+	t.Run("configured from env", func(t *testing.T) {
+		reset()
+		t.Setenv("ANALYTICS_MIXPANEL_TOKEN", "token")
+
+		a := Default()
+		defer a.Close()
+
+		assert.Same(t, a, Default())
+		assert.Same(t, DefaultAnalytics, a)
+		assert.Equal(t, "token", a.Sink.(*MixpanelSink).token)
+	})
+	t.Run("fields set before first use are kept", func(t *testing.T) {
+		reset()
+		logger := log.NewMockLogger(gomock.NewController(t))
+
+		var got Event
+		DefaultAnalytics.WithLogger(logger)
+		DefaultAnalytics.WithSink(sinkFunc(func(ctx context.Context, event Event) error {
+			got = event
+
+			return nil
+		}))
+
+		assert.NoError(t, DefaultAnalytics.TrackSync("eventName", nil))
+		assert.Equal(t, "eventName", got.Name)
+		assert.Equal(t, logger, DefaultAnalytics.Logger)
+		assert.NotNil(t, DefaultAnalytics.wp)
+		DefaultAnalytics.Close()
+	})
+	t.Run("replaced before first use", func(t *testing.T) {
+		reset()
+		//nolint:exhaustruct // accept default values at structs
+		DefaultAnalytics = &Analytics{}
+
+		assert.Same(t, DefaultAnalytics, Default())
+		assert.Nil(t, DefaultAnalytics.Sink)
+	})
+	t.Run("invalid env", func(t *testing.T) {
+		reset()
+		t.Setenv("ANALYTICS_SPOOL_MAX_BYTES", "not a number")
+
+		assert.Panics(t, func() { Default() })
+		assert.Panics(t, func() { Default() }, "error must be kept")
+	})
+	t.Run("close without use", func(t *testing.T) {
+		reset()
+		t.Setenv("ANALYTICS_SPOOL_MAX_BYTES", "not a number")
+
+		assert.NotPanics(t, Close)
+	})
+}
@@ -0,0 +1,254 @@
+/*
+Package analyticstest helps asserting analytics events sent by a service at
+unit tests.
+*/
+package analyticstest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/facily-tech/go-core/analytics"
+	"github.com/facily-tech/go-core/log"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	_ analytics.BatchSink   = (*Recorder)(nil)
+	_ analytics.ProfileSink = (*Recorder)(nil)
+)
+
+// TestingT is the subset of testing.TB used by assertions.
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+	Helper()
+}
+
+// Alias is a recorded alias operation.
+type Alias struct {
+	DistinctID string
+	NewID      string
+}
+
+// Recorder is an in-memory analytics.Sink keeping everything it receives.
+type Recorder struct {
+	mu      sync.Mutex
+	events  []analytics.Event
+	updates []analytics.ProfileUpdate
+	aliases []Alias
+}
+
+// NewRecorder creates an empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{
+		mu:      sync.Mutex{},
+		events:  nil,
+		updates: nil,
+		aliases: nil,
+	}
+}
+
+// New creates a synchronous analytics.Analytics delivering to a Recorder,
+// Track returns after the event is recorded. opts are applied after defaults.
+func New(t testing.TB, opts ...analytics.Option) (*analytics.Analytics, *Recorder) {
+	r := NewRecorder()
+
+	a, err := analytics.New(append([]analytics.Option{
+		analytics.OptionSink(r),
+		analytics.OptionLogger(testLogger{t}),
+		analytics.OptionSynchronous(),
+	}, opts...)...)
+	if err != nil {
+		// logger is always given, New can't fail.
+		panic(err)
+	}
+	t.Cleanup(a.Close)
+
+	return a, r
+}
+
+// Send records event.
+func (r *Recorder) Send(_ context.Context, event analytics.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, event)
+
+	return nil
+}
+
+// SendBatch records events.
+func (r *Recorder) SendBatch(_ context.Context, events []analytics.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, events...)
+
+	return nil
+}
+
+// UpdateProfile records update.
+func (r *Recorder) UpdateProfile(_ context.Context, update analytics.ProfileUpdate) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.updates = append(r.updates, update)
+
+	return nil
+}
+
+// Alias records alias.
+func (r *Recorder) Alias(_ context.Context, distinctID, newID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.aliases = append(r.aliases, Alias{DistinctID: distinctID, NewID: newID})
+
+	return nil
+}
+
+// Events returns recorded events, in order.
+func (r *Recorder) Events() []analytics.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]analytics.Event(nil), r.events...)
+}
+
+// EventsNamed returns recorded events with name, in order.
+func (r *Recorder) EventsNamed(name string) []analytics.Event {
+	var events []analytics.Event
+	for _, e := range r.Events() {
+		if e.Name == name {
+			events = append(events, e)
+		}
+	}
+
+	return events
+}
+
+// ProfileUpdates returns recorded profile updates, in order.
+func (r *Recorder) ProfileUpdates() []analytics.ProfileUpdate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]analytics.ProfileUpdate(nil), r.updates...)
+}
+
+// Aliases returns recorded aliases, in order.
+func (r *Recorder) Aliases() []Alias {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Alias(nil), r.aliases...)
+}
+
+// Reset discard everything recorded.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events, r.updates, r.aliases = nil, nil, nil
+}
+
+// AssertTracked asserts an event with name was recorded containing props,
+// other properties are ignored.
+func (r *Recorder) AssertTracked(t TestingT, name string, props map[string]interface{}) bool {
+	t.Helper()
+
+	events := r.EventsNamed(name)
+	for _, e := range events {
+		if containsProperties(e.Properties, props) {
+			return true
+		}
+	}
+
+	if len(events) == 0 {
+		return assert.Fail(t, fmt.Sprintf("event %q was not tracked", name), "tracked events: %v", r.names())
+	}
+
+	return assert.Fail(t, fmt.Sprintf("event %q was not tracked with properties %v", name, props),
+		"tracked %q properties: %v", name, properties(events))
+}
+
+// AssertNotTracked asserts no event with name was recorded.
+func (r *Recorder) AssertNotTracked(t TestingT, name string) bool {
+	t.Helper()
+
+	if events := r.EventsNamed(name); len(events) > 0 {
+		return assert.Fail(t, fmt.Sprintf("event %q was tracked %d times", name, len(events)),
+			"tracked %q properties: %v", name, properties(events))
+	}
+
+	return true
+}
+
+func (r *Recorder) names() []string {
+	events := r.Events()
+	names := make([]string, 0, len(events))
+	for _, e := range events {
+		names = append(names, e.Name)
+	}
+
+	return names
+}
+
+func containsProperties(got, want map[string]interface{}) bool {
+	for k, v := range want {
+		gotValue, ok := got[k]
+		if !ok || !assert.ObjectsAreEqual(v, gotValue) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func properties(events []analytics.Event) []map[string]interface{} {
+	props := make([]map[string]interface{}, 0, len(events))
+	for _, e := range events {
+		props = append(props, e.Properties)
+	}
+
+	return props
+}
+
+// testLogger write analytics logs using t.Logf, Fatal fails the test and
+// Panic panics, as zap would stop the caller.
+type testLogger struct {
+	t testing.TB
+}
+
+func (l testLogger) log(level, msg string, fields []log.Field) {
+	l.t.Helper()
+	l.t.Logf("analytics %s: %s %v", level, msg, fields)
+}
+
+func (l testLogger) Error(_ context.Context, msg string, fields ...log.Field) {
+	l.log("error", msg, fields)
+}
+
+func (l testLogger) Debug(_ context.Context, msg string, fields ...log.Field) {
+	l.log("debug", msg, fields)
+}
+
+func (l testLogger) Fatal(_ context.Context, msg string, fields ...log.Field) {
+	l.t.Helper()
+	l.t.Fatalf("analytics fatal: %s %v", msg, fields)
+}
+
+func (l testLogger) Info(_ context.Context, msg string, fields ...log.Field) {
+	l.log("info", msg, fields)
+}
+
+func (l testLogger) Panic(_ context.Context, msg string, fields ...log.Field) {
+	l.t.Helper()
+	l.log("panic", msg, fields)
+	panic(msg)
+}
+
+func (l testLogger) Warn(_ context.Context, msg string, fields ...log.Field) {
+	l.log("warn", msg, fields)
+}
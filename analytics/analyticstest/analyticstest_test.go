@@ -0,0 +1,73 @@
+package analyticstest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeT struct {
+	errors []string
+}
+
+func (f *fakeT) Errorf(format string, args ...interface{}) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeT) Helper() {}
+
+func TestNew(t *testing.T) {
+	a, r := New(t)
+
+	a.Track("purchase", map[string]interface{}{"orderId": "123", "value": 10})
+	a.SetProfile(context.Background(), "123", map[string]interface{}{"plan": "gold"})
+	a.Alias(context.Background(), "123", "456")
+
+	// synchronous, no need to wait.
+	assert.Len(t, r.Events(), 1)
+	r.AssertTracked(t, "purchase", map[string]interface{}{"orderId": "123"})
+	r.AssertNotTracked(t, "refund")
+	assert.Equal(t, "gold", r.ProfileUpdates()[0].Properties["plan"])
+	assert.Equal(t, []Alias{{DistinctID: "123", NewID: "456"}}, r.Aliases())
+
+	r.Reset()
+	assert.Empty(t, r.Events())
+	assert.Empty(t, r.ProfileUpdates())
+	assert.Empty(t, r.Aliases())
+}
+
+func TestRecorder_AssertTracked(t *testing.T) {
+	tests := []struct {
+		name  string
+		event string
+		props map[string]interface{}
+		want  bool
+	}{
+		{name: "name only", event: "purchase", props: nil, want: true},
+		{name: "subset of properties", event: "purchase", props: map[string]interface{}{"value": 10}, want: true},
+		{name: "different value", event: "purchase", props: map[string]interface{}{"value": 11}, want: false},
+		{name: "missing property", event: "purchase", props: map[string]interface{}{"coupon": "x"}, want: false},
+		{name: "not tracked", event: "refund", props: nil, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, r := New(t)
+			a.Track("purchase", map[string]interface{}{"orderId": "123", "value": 10})
+
+			ft := &fakeT{}
+			assert.Equal(t, tt.want, r.AssertTracked(ft, tt.event, tt.props))
+			assert.Equal(t, tt.want, len(ft.errors) == 0)
+		})
+	}
+}
+
+func TestRecorder_AssertNotTracked(t *testing.T) {
+	a, r := New(t)
+	a.Track("purchase", nil)
+
+	ft := &fakeT{}
+	assert.False(t, r.AssertNotTracked(ft, "purchase"))
+	assert.Len(t, ft.errors, 1)
+}
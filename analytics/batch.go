@@ -0,0 +1,223 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/facily-tech/go-core/log"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+)
+
+const (
+	defaultBatchSize     = 50
+	defaultBatchInterval = 5 * time.Second
+)
+
+// BatchSink is a Sink able to deliver many events at once.
+type BatchSink interface {
+	Sink
+	// SendBatch deliver events to the backend using a single request when possible.
+	SendBatch(ctx context.Context, events []Event) error
+}
+
+// BatchMetrics receive statistics of each flushed batch.
+type BatchMetrics interface {
+	// ObserveBatch is called after each flush with the amount of events, time
+	// spent delivering them and the delivery error, if any.
+	ObserveBatch(size int, latency time.Duration, err error)
+}
+
+// BatchMetricsFunc is an adapter to allow the use of ordinary functions as BatchMetrics.
+type BatchMetricsFunc func(size int, latency time.Duration, err error)
+
+// ObserveBatch calls f(size, latency, err).
+func (f BatchMetricsFunc) ObserveBatch(size int, latency time.Duration, err error) {
+	f(size, latency, err)
+}
+
+// BatchConfig controls when buffered events are flushed.
+type BatchConfig struct {
+	// Size is the maximum amount of events buffered before a flush, default 50.
+	Size int
+	// Interval is the maximum age of the oldest buffered event before a flush, default 5s.
+	Interval time.Duration
+	// Metrics can be nil.
+	Metrics BatchMetrics
+}
+
+// BatchError is returned by SendBatch when only some events were delivered,
+// retrying Events is enough to deliver the whole batch.
+type BatchError struct {
+	// Events not delivered.
+	Events []Event
+	Err    error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d events not delivered: %v", len(e.Events), e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// undelivered returns events of a batch which failed with err. Errors combined
+// by FanOutSink are not walked, each sink may have failed different events.
+func undelivered(err error, events []Event) []Event {
+	//nolint:errorlint // see above.
+	if batchErr, ok := errors.Cause(err).(*BatchError); ok {
+		return batchErr.Events
+	}
+
+	return events
+}
+
+// SendBatch deliver events to sink using BatchSink.SendBatch if sink supports
+// it, otherwise events are sent one by one.
+func SendBatch(ctx context.Context, sink Sink, events []Event) error {
+	if bs, ok := sink.(BatchSink); ok {
+		return bs.SendBatch(ctx, events)
+	}
+
+	return sendEach(ctx, sink, events)
+}
+
+// sendEach sends events one by one, failed ones are returned in a BatchError.
+func sendEach(ctx context.Context, sink Sink, events []Event) error {
+	var (
+		err    error
+		failed []Event
+	)
+	for _, e := range events {
+		if sendErr := sink.Send(ctx, e); sendErr != nil {
+			err = multierr.Append(err, sendErr)
+			failed = append(failed, e)
+		}
+	}
+	if err != nil {
+		return errors.WithStack(&BatchError{Events: failed, Err: err})
+	}
+
+	return nil
+}
+
+// batcher accumulate events until size or age threshold is reached and then
+// hand them over to flush.
+type batcher struct {
+	mu         sync.Mutex
+	buffer     []Event
+	timer      *time.Timer
+	generation uint64
+	config     BatchConfig
+	flush      func([]Event)
+}
+
+func newBatcher(config BatchConfig, flush func([]Event)) *batcher {
+	if config.Size <= 0 {
+		config.Size = defaultBatchSize
+	}
+	if config.Interval <= 0 {
+		config.Interval = defaultBatchInterval
+	}
+
+	return &batcher{
+		buffer: make([]Event, 0, config.Size),
+		config: config,
+		flush:  flush,
+	}
+}
+
+func (b *batcher) add(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buffer = append(b.buffer, event)
+	if len(b.buffer) == 1 {
+		generation := b.generation
+		b.timer = time.AfterFunc(b.config.Interval, func() { b.expire(generation) })
+	}
+
+	if len(b.buffer) >= b.config.Size {
+		b.flushLocked()
+	}
+}
+
+// expire flush buffer if it's still the one which started the timer.
+func (b *batcher) expire(generation uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation == b.generation {
+		b.flushLocked()
+	}
+}
+
+// close flush any buffered event.
+func (b *batcher) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.flushLocked()
+}
+
+func (b *batcher) flushLocked() {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.generation++
+
+	if len(b.buffer) == 0 {
+		return
+	}
+
+	events := b.buffer
+	b.buffer = make([]Event, 0, b.config.Size)
+	b.flush(events)
+}
+
+// WithBatching buffer events sent by Track and deliver them in batches using
+// the worker pool, see BatchConfig. Close flush buffered events.
+
+// WithBatching is a wrapper around DefaultClient.WithBatching.
+func WithBatching(config BatchConfig) {
+	Default().WithBatching(config)
+}
+
+// WithBatching buffer events sent by Track and deliver them in batches using
+// the worker pool, see BatchConfig. Close flush buffered events.
+func (a *Analytics) WithBatching(config BatchConfig) {
+	a.initDefault()
+
+	if a.batcher != nil {
+		a.batcher.close()
+	}
+
+	a.batcher = newBatcher(config, func(events []Event) {
+		a.wp.Submit(func() {
+			start := time.Now()
+			err := a.deliverBatch(context.Background(), events)
+			if config.Metrics != nil {
+				config.Metrics.ObserveBatch(len(events), time.Since(start), err)
+			}
+			if err != nil {
+				failed := undelivered(err, events)
+				a.Logger.Error(context.Background(), "Error sending batch to sink",
+					log.Any("size", len(failed)), log.Error(err))
+				a.toDeadLetter(err, failed...)
+			}
+		})
+	})
+}
+
+func (a *Analytics) sendBatch(ctx context.Context, events []Event) error {
+	sink := a.sink()
+	if sink == nil {
+		return errors.WithStack(ErrNoSink)
+	}
+
+	return SendBatch(ctx, sink, events)
+}
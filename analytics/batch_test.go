@@ -0,0 +1,149 @@
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/facily-tech/go-core/log"
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type batchRecorder struct {
+	mu      sync.Mutex
+	batches [][]Event
+}
+
+func (b *batchRecorder) Send(ctx context.Context, event Event) error {
+	return b.SendBatch(ctx, []Event{event})
+}
+
+func (b *batchRecorder) SendBatch(_ context.Context, events []Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.batches = append(b.batches, events)
+
+	return nil
+}
+
+func (b *batchRecorder) sizes() []int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sizes := make([]int, len(b.batches))
+	for i := range b.batches {
+		sizes[i] = len(b.batches[i])
+	}
+
+	return sizes
+}
+
+func TestAnalytics_WithBatching(t *testing.T) {
+	t.Run("flush when size is reached and drain at close", func(t *testing.T) {
+		sink := &batchRecorder{}
+		var observed []int
+		a := &Analytics{
+			Sink:   sink,
+			Logger: log.NewMockLogger(gomock.NewController(t)),
+		}
+		a.WithWorkerPool(1)
+		a.WithBatching(BatchConfig{
+			Size:     2,
+			Interval: time.Hour,
+			Metrics: BatchMetricsFunc(func(size int, latency time.Duration, err error) {
+				assert.NoError(t, err)
+				observed = append(observed, size)
+			}),
+		})
+
+		for i := 0; i < 5; i++ {
+			a.Track("eventName", map[string]interface{}{"propertie": i})
+		}
+		a.Close()
+
+		assert.Equal(t, []int{2, 2, 1}, sink.sizes())
+		assert.Equal(t, []int{2, 2, 1}, observed)
+	})
+	t.Run("flush when interval expires", func(t *testing.T) {
+		sink := &batchRecorder{}
+		a := &Analytics{
+			Sink:   sink,
+			Logger: log.NewMockLogger(gomock.NewController(t)),
+		}
+		a.WithWorkerPool(1)
+		a.WithBatching(BatchConfig{
+			Size:     100,
+			Interval: time.Millisecond,
+			Metrics:  nil,
+		})
+		defer a.Close()
+
+		a.Track("eventName", map[string]interface{}{"propertie": "value"})
+
+		assert.Eventually(t, func() bool {
+			return len(sink.sizes()) == 1
+		}, time.Second, time.Millisecond)
+	})
+}
+
+func TestSendBatch(t *testing.T) {
+	sent := 0
+	err := SendBatch(context.Background(), sinkFunc(func(ctx context.Context, event Event) error {
+		sent++
+
+		return nil
+	}), []Event{{Name: "a"}, {Name: "b"}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, sent)
+
+	errSink := errors.New("sink error")
+	err = SendBatch(context.Background(), sinkFunc(func(ctx context.Context, event Event) error {
+		if event.Name == "b" {
+			return errSink
+		}
+
+		return nil
+	}), []Event{{Name: "a"}, {Name: "b"}})
+
+	var batchErr *BatchError
+	assert.ErrorAs(t, err, &batchErr)
+	assert.ErrorIs(t, err, errSink)
+	assert.Equal(t, []Event{{Name: "b"}}, batchErr.Events)
+}
+
+func TestAnalytics_deliverBatch(t *testing.T) {
+	var sizes []int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var got []mixpanelImport
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		sizes = append(sizes, len(got))
+
+		// only the first chunk fails, once.
+		if len(sizes) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	a := Analytics{
+		Sink:   NewMixpanelSinkWithSecret("token", "secret", ts.URL),
+		Logger: nil,
+	}
+	a.WithRetry(RetryPolicy{Attempts: 2, InitialBackoff: time.Millisecond})
+
+	events := make([]Event, mixpanelImportLimit+1)
+	for i := range events {
+		events[i] = Event{Name: "a"}
+	}
+
+	assert.NoError(t, a.deliverBatch(context.Background(), events))
+	assert.Equal(t, []int{mixpanelImportLimit, 1, mixpanelImportLimit}, sizes)
+}
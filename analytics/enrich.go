@@ -0,0 +1,131 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/facily-tech/go-core/telemetry"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Property names filled by the built-in enrichers.
+const (
+	PropertyCustomerID = "customerId"
+	PropertySubject    = "subject"
+	PropertyRequestID  = "requestId"
+	PropertyTraceID    = "traceId"
+	PropertySpanID     = "spanId"
+)
+
+// Enricher add information from ctx to event before it's queued. Enrichers
+// should not overwrite properties or DistinctID already set.
+type Enricher interface {
+	Enrich(ctx context.Context, event *Event)
+}
+
+// EnricherFunc is an adapter to allow the use of ordinary functions as Enricher.
+type EnricherFunc func(ctx context.Context, event *Event)
+
+// Enrich calls f(ctx, event).
+func (f EnricherFunc) Enrich(ctx context.Context, event *Event) {
+	f(ctx, event)
+}
+
+// ContextValueEnricher set property using value returned by getValue, nothing
+// is done if getValue returns false.
+func ContextValueEnricher(property string, getValue func(context.Context) (interface{}, bool)) Enricher {
+	return EnricherFunc(func(ctx context.Context, event *Event) {
+		if v, ok := getValue(ctx); ok {
+			setProperty(event, property, v)
+		}
+	})
+}
+
+// CustomerIDEnricher set customerId property and DistinctID using
+// getCustomerID, generally http/server/middleware.CustomerIDKey.Get, nothing
+// is done if it returns false.
+func CustomerIDEnricher(getCustomerID func(context.Context) (string, bool)) Enricher {
+	return EnricherFunc(func(ctx context.Context, event *Event) {
+		id, ok := getCustomerID(ctx)
+		if !ok || id == "" {
+			return
+		}
+
+		setProperty(event, PropertyCustomerID, id)
+		setDistinctID(event, id)
+	})
+}
+
+// SubjectEnricher set subject property and DistinctID using the "sub" claim
+// returned by getRootClaim, generally auth.GetRootClaim.
+func SubjectEnricher(getRootClaim func(context.Context, string) interface{}) Enricher {
+	return EnricherFunc(func(ctx context.Context, event *Event) {
+		sub, ok := getRootClaim(ctx, "sub").(string)
+		if !ok || sub == "" {
+			return
+		}
+
+		setProperty(event, PropertySubject, sub)
+		setDistinctID(event, sub)
+	})
+}
+
+// RequestIDEnricher set requestId property using the id created by chi
+// middleware.RequestID.
+func RequestIDEnricher() Enricher {
+	return EnricherFunc(func(ctx context.Context, event *Event) {
+		if id := middleware.GetReqID(ctx); id != "" {
+			setProperty(event, PropertyRequestID, id)
+		}
+	})
+}
+
+// TraceEnricher set traceId and spanId properties using the span at ctx.
+func TraceEnricher(tracer telemetry.Tracer) Enricher {
+	return EnricherFunc(func(ctx context.Context, event *Event) {
+		span, ok := tracer.SpanFromContext(ctx)
+		if !ok {
+			return
+		}
+
+		setProperty(event, PropertyTraceID, fmt.Sprint(span.Context().TraceID()))
+		setProperty(event, PropertySpanID, fmt.Sprint(span.Context().SpanID()))
+	})
+}
+
+func setProperty(event *Event, key string, value interface{}) {
+	if _, ok := event.Properties[key]; ok {
+		return
+	}
+	if event.Properties == nil {
+		event.Properties = make(map[string]interface{})
+	}
+
+	event.Properties[key] = value
+}
+
+func setDistinctID(event *Event, id string) {
+	if event.DistinctID == "" {
+		event.DistinctID = id
+	}
+}
+
+// WithEnrichers append enrichers applied, in order, to events sent using
+// TrackContext and TrackSyncContext.
+
+// WithEnrichers is a wrapper around DefaultClient.WithEnrichers.
+func WithEnrichers(enrichers ...Enricher) {
+	Default().WithEnrichers(enrichers...)
+}
+
+// WithEnrichers append enrichers applied, in order, to events sent using
+// TrackContext and TrackSyncContext.
+func (a *Analytics) WithEnrichers(enrichers ...Enricher) {
+	a.enrichers = append(a.enrichers, enrichers...)
+}
+
+func (a *Analytics) enrich(ctx context.Context, event *Event) {
+	for _, e := range a.enrichers {
+		e.Enrich(ctx, event)
+	}
+}
@@ -0,0 +1,141 @@
+package analytics
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/facily-tech/go-core/log"
+	"github.com/facily-tech/go-core/telemetry"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+type customerIDKey struct{}
+
+func getCustomerID(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(customerIDKey{}).(string)
+
+	return id, ok
+}
+
+type claimsKey struct{}
+
+func getRootClaim(ctx context.Context, claim string) interface{} {
+	claims, ok := ctx.Value(claimsKey{}).(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	return claims[claim]
+}
+
+type fakeTracer struct{}
+
+func (fakeTracer) Middleware(next http.Handler) http.Handler { return next }
+func (fakeTracer) Client(parent *http.Client) *http.Client   { return parent }
+func (fakeTracer) Close()                                    {}
+func (fakeTracer) Name() telemetry.Name                      { return "fake" }
+func (fakeTracer) SpanFromContext(ctx context.Context) (telemetry.Span, bool) {
+	return fakeSpan{}, true
+}
+
+type fakeSpan struct{}
+
+func (fakeSpan) Context() telemetry.SpanContext { return fakeSpan{} }
+func (fakeSpan) SpanID() uint64                 { return 2 }
+func (fakeSpan) TraceID() uint64                { return 1 }
+func (fakeSpan) ToMap() map[string]interface{}  { return nil }
+
+func TestAnalytics_TrackSyncContext(t *testing.T) {
+	ctx := context.WithValue(context.Background(), customerIDKey{}, "42")
+	ctx = context.WithValue(ctx, claimsKey{}, map[string]interface{}{"sub": "3f52960a"})
+	ctx = context.WithValue(ctx, middleware.RequestIDKey, "host/abc-000001")
+
+	tests := []struct {
+		name           string
+		ctx            context.Context //nolint:containedctx
+		properties     map[string]interface{}
+		wantDistinctID string
+		wantProperties map[string]interface{}
+	}{
+		{
+			name:           "every enricher",
+			ctx:            ctx,
+			properties:     map[string]interface{}{"propertie": "value"},
+			wantDistinctID: "42",
+			wantProperties: map[string]interface{}{
+				"propertie":        "value",
+				PropertyCustomerID: "42",
+				PropertySubject:    "3f52960a",
+				PropertyRequestID:  "host/abc-000001",
+				PropertyTraceID:    "1",
+				PropertySpanID:     "2",
+			},
+		},
+		{
+			name:           "explicit values are kept",
+			ctx:            ctx,
+			properties:     map[string]interface{}{"distinctId": "me", PropertyRequestID: "mine"},
+			wantDistinctID: "me",
+			wantProperties: map[string]interface{}{
+				"distinctId":       "me",
+				PropertyCustomerID: "42",
+				PropertySubject:    "3f52960a",
+				PropertyRequestID:  "mine",
+				PropertyTraceID:    "1",
+				PropertySpanID:     "2",
+			},
+		},
+		{
+			name:           "subject is used when there is no customer",
+			ctx:            context.WithValue(context.Background(), claimsKey{}, map[string]interface{}{"sub": "3f52960a"}),
+			properties:     nil,
+			wantDistinctID: "3f52960a",
+			wantProperties: map[string]interface{}{
+				PropertySubject: "3f52960a",
+				PropertyTraceID: "1",
+				PropertySpanID:  "2",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Event
+			a := &Analytics{
+				Sink: sinkFunc(func(ctx context.Context, event Event) error {
+					got = event
+
+					return nil
+				}),
+				Logger: log.NewMockLogger(gomock.NewController(t)),
+			}
+			a.WithEnrichers(
+				CustomerIDEnricher(getCustomerID),
+				SubjectEnricher(getRootClaim),
+				RequestIDEnricher(),
+				TraceEnricher(fakeTracer{}),
+			)
+
+			assert.NoError(t, a.TrackSyncContext(tt.ctx, "eventName", tt.properties))
+			assert.Equal(t, tt.wantDistinctID, got.DistinctID)
+			assert.Equal(t, tt.wantProperties, got.Properties)
+		})
+	}
+}
+
+func TestContextValueEnricher(t *testing.T) {
+	e := ContextValueEnricher("tenant", func(ctx context.Context) (interface{}, bool) {
+		v, ok := ctx.Value(claimsKey{}).(string)
+
+		return v, ok
+	})
+
+	event := Event{}
+	e.Enrich(context.Background(), &event)
+	assert.Empty(t, event.Properties)
+
+	e.Enrich(context.WithValue(context.Background(), claimsKey{}, "facily"), &event)
+	assert.Equal(t, map[string]interface{}{"tenant": "facily"}, event.Properties)
+}
@@ -6,11 +6,15 @@ require (
 	github.com/dukex/mixpanel v1.0.1
 	github.com/facily-tech/go-core/env v0.1.0
 	github.com/facily-tech/go-core/log v0.2.1
+	github.com/facily-tech/go-core/telemetry v0.3.0
 	github.com/gammazero/workerpool v1.1.3
+	github.com/go-chi/chi/v5 v5.0.7
 	github.com/golang/mock v1.6.0
 	github.com/google/uuid v1.3.0
 	github.com/pkg/errors v0.9.1
 	github.com/stretchr/testify v1.7.0
+	go.uber.org/multierr v1.6.0
+	golang.org/x/time v0.0.0-20211116232009-f0f3c7e86c11
 )
 
 require (
@@ -18,9 +22,7 @@ require (
 	github.com/DataDog/sketches-go v1.0.0 // indirect
 	github.com/Microsoft/go-winio v0.5.1 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/facily-tech/go-core/telemetry v0.3.0 // indirect
 	github.com/gammazero/deque v0.2.0 // indirect
-	github.com/go-chi/chi/v5 v5.0.7 // indirect
 	github.com/golang/protobuf v1.4.1 // indirect
 	github.com/newrelic/go-agent/v3 v3.15.1 // indirect
 	github.com/philhofer/fwd v1.1.1 // indirect
@@ -28,12 +30,10 @@ require (
 	github.com/sethvargo/go-envconfig v0.3.5 // indirect
 	github.com/tinylib/msgp v1.1.2 // indirect
 	go.uber.org/atomic v1.7.0 // indirect
-	go.uber.org/multierr v1.6.0 // indirect
 	go.uber.org/zap v1.19.1 // indirect
 	golang.org/x/net v0.0.0-20210405180319-a5a99cb37ef4 // indirect
 	golang.org/x/sys v0.0.0-20210510120138-977fb7262007 // indirect
 	golang.org/x/text v0.3.3 // indirect
-	golang.org/x/time v0.0.0-20211116232009-f0f3c7e86c11 // indirect
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
 	google.golang.org/genproto v0.0.0-20200526211855-cb27e3aa2013 // indirect
 	google.golang.org/grpc v1.27.0 // indirect
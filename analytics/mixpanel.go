@@ -1,176 +1,186 @@
 package analytics
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
 
 	"github.com/dukex/mixpanel"
-	"github.com/facily-tech/go-core/env"
-	"github.com/facily-tech/go-core/log"
-	"github.com/gammazero/workerpool"
-	"github.com/google/uuid"
 	"github.com/pkg/errors"
+	"go.uber.org/multierr"
 )
 
 const (
-	prefix   = "ANALYTICS_"
-	poolSize = 5
+	mixpanelDefaultURL = "https://api.mixpanel.com"
+	mixpanelImportPath = "/import"
+	// mixpanelImportLimit is the maximum events accepted by a single import request.
+	mixpanelImportLimit = 2000
+	// mixpanelInsertID is the property mixpanel uses to deduplicate events.
+	mixpanelInsertID = "$insert_id"
 )
 
-type config struct {
-	Token string `env:"MIXPANEL_TOKEN"`
-}
+// ErrEmptySecret error when secret is empty and it's required, like at
+// mixpanel import api.
+//
+// Deprecated: SendBatch sends events one by one when there is no secret, it
+// is no longer returned.
+var ErrEmptySecret = errors.New("secret cannot be empty, use NewMixpanelSinkWithSecret")
 
-// Analytics is an wrapper over mixpanel package.
-type Analytics struct {
-	MixpanelEvent mixpanel.Mixpanel
-	Logger        log.Logger
+var _ BatchSink = (*MixpanelSink)(nil)
 
-	token string
-	wp    workerPool
-}
+// MixpanelSink is a Sink wrapper over mixpanel package.
+type MixpanelSink struct {
+	Client     mixpanel.Mixpanel
+	HTTPClient *http.Client
 
-type workerPool interface {
-	StopWait()
-	Submit(func())
+	token  string
+	secret string
+	url    string
 }
 
-var (
-	// DefaultAnalytics is used if you didn't create your own instance.
-	DefaultAnalytics = &Analytics{}
+type mixpanelImport struct {
+	Event      string                 `json:"event"`
+	Properties map[string]interface{} `json:"properties"`
+}
 
-	// ErrUnexpectedType error when we can't cast/type assert interface to (T).
-	ErrUnexpctedType = errors.New("cannot cast to desired type")
-	// ErrEmptyToken error when token is empty.
-	ErrEmptyToken = errors.New("token cannot by empty, use WithMixpanelURL")
-)
+// NewMixpanelSink returns a Sink delivering events to mixpanel. url can be empty
+// and will default to "https://api.mixpanel.com".
+func NewMixpanelSink(token, url string) *MixpanelSink {
+	return NewMixpanelSinkWithSecret(token, "", url)
+}
 
-//nolint:gochecknoinits // try to load token from env.
-func init() {
-	var c config
-	if err := env.LoadEnv(context.Background(), &c, prefix); err != nil {
-		panic(err)
+// NewMixpanelSinkWithSecret returns a Sink delivering events to mixpanel, secret
+// is the project api secret required by SendBatch. url can be empty and will
+// default to "https://api.mixpanel.com".
+func NewMixpanelSinkWithSecret(token, secret, url string) *MixpanelSink {
+	if url == "" {
+		url = mixpanelDefaultURL
 	}
 
-	logger, err := log.NewLoggerZap(log.ZapConfig{})
-	if err != nil {
-		panic(err)
+	return &MixpanelSink{
+		Client:     mixpanel.NewWithSecret(token, secret, url),
+		HTTPClient: http.DefaultClient,
+		token:      token,
+		secret:     secret,
+		url:        url,
 	}
-
-	DefaultAnalytics.MixpanelEvent = mixpanel.New(c.Token, "")
-	DefaultAnalytics.token = c.Token
-	DefaultAnalytics.Logger = logger
-	DefaultAnalytics.wp = workerpool.New(poolSize)
 }
 
-// WithWorkerPool stop current work pool if already running and creates
-// a new one with size workers.
+// Send event using mixpanel track api.
+func (m *MixpanelSink) Send(_ context.Context, event Event) error {
+	if m.token == "" {
+		return errors.WithStack(ErrEmptyToken)
+	}
 
-// WithWorkerPool is a wrapper around DefaultClient.WithWorkerPool.
-func WithWorkerPool(size int) {
-	if DefaultAnalytics.wp != nil {
-		DefaultAnalytics.wp.StopWait()
+	var timestamp *time.Time
+	if !event.Timestamp.IsZero() {
+		timestamp = &event.Timestamp
 	}
-	DefaultAnalytics.wp = workerpool.New(size)
-}
 
-// WithWorkerPool stop current work pool if already running and creates
-// a new one with size workers.
-func (a *Analytics) WithWorkerPool(size int) {
-	if a.wp != nil {
-		a.wp.StopWait()
+	props := event.Properties
+	if event.InsertID != "" {
+		props = make(map[string]interface{}, len(event.Properties)+1)
+		for k, v := range event.Properties {
+			props[k] = v
+		}
+		props[mixpanelInsertID] = event.InsertID
 	}
-	a.wp = workerpool.New(size)
-}
 
-// WithLogger change current log.Logger to externalLogger.
+	if err := m.Client.Track(event.DistinctID, event.Name, &mixpanel.Event{
+		IP:         "",
+		Timestamp:  timestamp,
+		Properties: props,
+	}); err != nil {
+		return errors.WithStack(err)
+	}
 
-// WithLogger is a wrapper around DefaultClient.WithLogger.
-func WithLogger(externalLogger log.Logger) {
-	DefaultAnalytics.WithLogger(externalLogger)
+	return nil
 }
 
-// WithLogger change current log.Logger to externalLogger.
-func (a *Analytics) WithLogger(externalLogger log.Logger) {
-	a.Logger = externalLogger
-}
+// SendBatch events using mixpanel import api, requests are split to respect
+// mixpanel limit of events per request. Without secret, required by import
+// api, events are sent one by one using track api, which ignores events older
+// than 5 days.
+func (m *MixpanelSink) SendBatch(ctx context.Context, events []Event) error {
+	if m.token == "" {
+		return errors.WithStack(ErrEmptyToken)
+	}
+	if m.secret == "" {
+		return sendEach(ctx, m, events)
+	}
 
-// WithMixpanelURL client token and url. url can be empty and will default to
-// "https://api.mixpanel.com".
+	// a failed chunk do not stop the others, so retries resend only failed ones.
+	var (
+		err    error
+		failed []Event
+	)
+	for start := 0; start < len(events); start += mixpanelImportLimit {
+		end := start + mixpanelImportLimit
+		if end > len(events) {
+			end = len(events)
+		}
 
-// WithMixpanelURL is a wrapper around DefaultClient.WithMixpanelURL.
-func WithMixpanelURL(token, url string) {
-	DefaultAnalytics.MixpanelEvent = mixpanel.New(token, url)
-}
+		if chunkErr := m.importEvents(ctx, events[start:end]); chunkErr != nil {
+			err = multierr.Append(err, chunkErr)
+			failed = append(failed, events[start:end]...)
+		}
+	}
+	if err != nil {
+		return errors.WithStack(&BatchError{Events: failed, Err: err})
+	}
 
-// WithMixpanelURL client token and url. url can be empty and will default to
-// "https://api.mixpanel.com".
-func (a *Analytics) WithMixpanelURL(token, url string) {
-	a.token = token
-	a.MixpanelEvent = mixpanel.New(token, url)
+	return nil
 }
 
-// Track queue an eventName with the following properties to be sent.
-func (a *Analytics) Track(eventName string, properties map[string]interface{}) {
-	a.wp.Submit(func() {
-		err := a.dispatchEvent(eventName, properties)
-		if err != nil {
-			a.Logger.Error(context.Background(), "Error sending event to mixpanel", log.Error(err))
+func (m *MixpanelSink) importEvents(ctx context.Context, events []Event) error {
+	payload := make([]mixpanelImport, len(events))
+	for i, e := range events {
+		timestamp := e.Timestamp
+		if timestamp.IsZero() {
+			timestamp = time.Now()
 		}
-	})
-}
-
-// Track queue an eventName with the following properties to be sent.
 
-// Track is a wrapper around DefaultClient.Track.
-func Track(eventName string, properties map[string]interface{}) {
-	DefaultAnalytics.Track(eventName, properties)
-}
+		props := make(map[string]interface{}, len(e.Properties)+4)
+		for k, v := range e.Properties {
+			props[k] = v
+		}
+		props["token"] = m.token
+		props["distinct_id"] = e.DistinctID
+		props["time"] = timestamp.UnixMilli()
+		props[mixpanelInsertID] = e.insertID()
 
-// TrackSync send an eventName with the following properties.
+		payload[i] = mixpanelImport{Event: e.Name, Properties: props}
+	}
 
-// TrackSync is a wrapper around DefaultClient.TrackSync.
-func TrackSync(eventName string, properties map[string]interface{}) error {
-	return DefaultAnalytics.dispatchEvent(eventName, properties)
-}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal mixpanel events")
+	}
 
-// TrackSync send an eventName with the following properties.
-func (a *Analytics) TrackSync(eventName string, properties map[string]interface{}) error {
-	return a.dispatchEvent(eventName, properties)
-}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.url+mixpanelImportPath, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "cannot create mixpanel request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(m.secret, "")
 
-func (a *Analytics) dispatchEvent(eventName string, properties map[string]interface{}) error {
-	distinctID := uuid.NewString()
-	if properties["distinctId"] != nil {
-		d, ok := properties["distinctId"].(string)
-		if !ok {
-			return errors.Wrap(ErrUnexpctedType, "distinctId is not a string")
-		}
-		distinctID = d
+	resp, err := m.HTTPClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "cannot send events to mixpanel")
 	}
+	defer resp.Body.Close()
 
-	if a.token == "" {
-		return errors.WithStack(ErrEmptyToken)
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "cannot read mixpanel response")
 	}
 
-	if err := a.MixpanelEvent.Track(distinctID, eventName, &mixpanel.Event{
-		IP:         "",
-		Timestamp:  nil,
-		Properties: properties,
-	}); err != nil {
-		return errors.WithStack(err)
+	if resp.StatusCode != http.StatusOK {
+		return errors.WithStack(&StatusError{StatusCode: resp.StatusCode, Body: string(respBody)})
 	}
 
 	return nil
 }
-
-// Close wait for events to be sent and stop worker pool.
-func (a *Analytics) Close() {
-	a.wp.StopWait()
-}
-
-// Close wait for events to be sent and stop worker pool.
-
-// Close is a wrapper around DefaultClient.Close.
-func Close() {
-	DefaultAnalytics.wp.StopWait()
-}
@@ -2,6 +2,12 @@
 package analytics
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
 	"time"
 
@@ -62,44 +68,66 @@ func (m *MixMock) Alias(distinctId, newId string) error {
 func TestTrackSync(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
 		a := Analytics{
-			MixpanelEvent: nil,
-			Logger:        nil,
-			token:         "",
+			Sink:   nil,
+			Logger: nil,
 		}
 		a.WithMixpanelURL("token", "")
 		logger := log.NewMockLogger(gomock.NewController(t))
 		a.Logger = logger
-		a.MixpanelEvent = &mixpanel.Mock{People: make(map[string]*mixpanel.MockPeople)}
+		a.Sink.(*MixpanelSink).Client = &mixpanel.Mock{People: make(map[string]*mixpanel.MockPeople)}
 
 		err := a.TrackSync("eventName", map[string]interface{}{"propertie": "value"})
 		assert.NoError(t, err)
 	})
+	t.Run("deprecated MixpanelEvent replaced", func(t *testing.T) {
+		a := Analytics{
+			Sink:   nil,
+			Logger: nil,
+		}
+		a.WithMixpanelURL("token", "")
+		a.Logger = log.NewMockLogger(gomock.NewController(t))
+
+		var got string
+		a.MixpanelEvent = &MixMock{
+			trackF: func(distinctId, eventName string, e *mixpanel.Event) error {
+				got = eventName
+
+				return nil
+			},
+		}
+
+		err := a.TrackSync("eventName", map[string]interface{}{"propertie": "value"})
+		assert.NoError(t, err)
+		assert.Equal(t, "eventName", got)
+	})
 	t.Run("no token", func(t *testing.T) {
 		a := Analytics{
-			MixpanelEvent: nil,
-			Logger:        nil,
-			token:         "",
+			Sink:   nil,
+			Logger: nil,
 		}
 		logger := log.NewMockLogger(gomock.NewController(t))
 		a.Logger = logger
-		a.MixpanelEvent = &MixMock{}
+		//nolint:exhaustruct // accept default values at structs
+		a.Sink = &MixpanelSink{Client: &MixMock{}}
 
 		err := a.TrackSync("eventName", map[string]interface{}{"propertie": "value"})
 		assert.Error(t, err)
 	})
 	t.Run("mixpanel event must fail", func(t *testing.T) {
 		a := Analytics{
-			MixpanelEvent: nil,
-			Logger:        nil,
-			token:         "token",
+			Sink:   nil,
+			Logger: nil,
 		}
 		logger := log.NewMockLogger(gomock.NewController(t))
 		a.Logger = logger
 		//nolint:exhaustruct // accept default values at structs
-		a.MixpanelEvent = &MixMock{
-			trackF: func(distinctId, eventName string, e *mixpanel.Event) error {
-				return errors.New("random error")
+		a.Sink = &MixpanelSink{
+			Client: &MixMock{
+				trackF: func(distinctId, eventName string, e *mixpanel.Event) error {
+					return errors.New("random error")
+				},
 			},
+			token: "token",
 		}
 
 		err := a.TrackSync("eventName", map[string]interface{}{"propertie": "value"})
@@ -107,9 +135,8 @@ func TestTrackSync(t *testing.T) {
 	})
 	t.Run("async track", func(t *testing.T) {
 		a := Analytics{
-			MixpanelEvent: nil,
-			Logger:        nil,
-			token:         "token",
+			Sink:   nil,
+			Logger: nil,
 		}
 		logger := log.NewMockLogger(gomock.NewController(t))
 		a.Logger = logger
@@ -117,12 +144,15 @@ func TestTrackSync(t *testing.T) {
 		done := make(chan struct{})
 		a.WithWorkerPool(poolSize)
 		//nolint:exhaustruct // accept default values at structs
-		a.MixpanelEvent = &MixMock{
-			trackF: func(distinctId, eventName string, e *mixpanel.Event) error {
-				defer func() { done <- struct{}{} }()
+		a.Sink = &MixpanelSink{
+			Client: &MixMock{
+				trackF: func(distinctId, eventName string, e *mixpanel.Event) error {
+					defer func() { done <- struct{}{} }()
 
-				return nil
+					return nil
+				},
 			},
+			token: "token",
 		}
 
 		a.Track("eventName", map[string]interface{}{"propertie": "value"})
@@ -132,4 +162,93 @@ func TestTrackSync(t *testing.T) {
 		case <-done:
 		}
 	})
+	t.Run("no sink", func(t *testing.T) {
+		a := Analytics{
+			Sink:   nil,
+			Logger: nil,
+		}
+
+		err := a.TrackSync("eventName", map[string]interface{}{"propertie": "value"})
+		assert.ErrorIs(t, err, ErrNoSink)
+	})
+}
+
+func TestMixpanelSink_Send(t *testing.T) {
+	var got url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.Query()
+		_, _ = w.Write([]byte(`{"status": 1}`))
+	}))
+	defer ts.Close()
+
+	s := NewMixpanelSink("token", ts.URL)
+	err := s.Send(context.Background(), Event{
+		Name:       "eventName",
+		DistinctID: "123",
+		Timestamp:  time.Time{},
+		Properties: map[string]interface{}{"propertie": "value"},
+	})
+	assert.NoError(t, err)
+
+	data, err := base64.StdEncoding.DecodeString(got.Get("data"))
+	assert.NoError(t, err)
+	assert.JSONEq(t,
+		`{"event": "eventName", "properties": {"distinct_id": "123", "token": "token", "propertie": "value"}}`,
+		string(data),
+	)
+}
+
+func TestMixpanelSink_SendBatch(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		var got []mixpanelImport
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, mixpanelImportPath, r.URL.Path)
+
+			user, _, ok := r.BasicAuth()
+			assert.True(t, ok)
+			assert.Equal(t, "secret", user)
+
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		}))
+		defer ts.Close()
+
+		s := NewMixpanelSinkWithSecret("token", "secret", ts.URL)
+		err := s.SendBatch(context.Background(), []Event{
+			{Name: "a", DistinctID: "1", Timestamp: time.Now(), Properties: map[string]interface{}{"propertie": "value"}},
+			{Name: "b", DistinctID: "2", Timestamp: time.Now(), Properties: nil, InsertID: "b-1"},
+		})
+		assert.NoError(t, err)
+
+		assert.Len(t, got, 2)
+		assert.Equal(t, "a", got[0].Event)
+		assert.Equal(t, "1", got[0].Properties["distinct_id"])
+		assert.Equal(t, "value", got[0].Properties["propertie"])
+		assert.NotEmpty(t, got[0].Properties["$insert_id"])
+		assert.Equal(t, "b", got[1].Event)
+		assert.Equal(t, "b-1", got[1].Properties["$insert_id"])
+	})
+	t.Run("mixpanel fail", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer ts.Close()
+
+		err := NewMixpanelSinkWithSecret("token", "secret", ts.URL).SendBatch(context.Background(), []Event{{Name: "a"}})
+
+		var statusErr *StatusError
+		assert.ErrorAs(t, err, &statusErr)
+		assert.Equal(t, http.StatusBadRequest, statusErr.StatusCode)
+	})
+	t.Run("no secret sends one by one", func(t *testing.T) {
+		var paths []string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			paths = append(paths, r.URL.Path)
+			_, _ = w.Write([]byte(`{"status": 1}`))
+		}))
+		defer ts.Close()
+
+		err := NewMixpanelSink("token", ts.URL).SendBatch(context.Background(), []Event{{Name: "a"}, {Name: "b"}})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"/track", "/track"}, paths)
+	})
 }
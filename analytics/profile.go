@@ -0,0 +1,333 @@
+package analytics
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/dukex/mixpanel"
+	"github.com/facily-tech/go-core/log"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+)
+
+// Profile operations supported by ProfileUpdate.
+const (
+	OperationSet     = "$set"
+	OperationSetOnce = "$set_once"
+	OperationAdd     = "$add"
+	OperationUnion   = "$union"
+	OperationUnset   = "$unset"
+
+	identifyEvent        = "$identify"
+	propertyIdentifiedID = "$identified_id"
+	propertyAnonID       = "$anon_id"
+
+	// profile operations handed to dead letter are events named after the
+	// operation, aliases use aliasEvent and groups have key and id properties.
+	aliasEvent       = "$create_alias"
+	propertyAlias    = "alias"
+	propertyGroupKey = "$group_key"
+	propertyGroupID  = "$group_id"
+)
+
+// ErrProfileUnsupported error when sink do not implement ProfileSink.
+var ErrProfileUnsupported = errors.New("sink do not support profile operations")
+
+// ProfileUpdate is an operation over a user profile or, when GroupKey is
+// present, over a group profile.
+type ProfileUpdate struct {
+	// DistinctID of the user, ignored at group updates.
+	DistinctID string
+	// GroupKey and GroupID identify the group, ex: "company", "facily".
+	GroupKey string
+	GroupID  string
+	// Operation is one of Operation* constants.
+	Operation string
+	// Properties changed by operation.
+	Properties map[string]interface{}
+}
+
+// ProfileSink is a Sink able to manage user and group profiles.
+type ProfileSink interface {
+	Sink
+	// UpdateProfile apply update to user or group profile.
+	UpdateProfile(ctx context.Context, update ProfileUpdate) error
+	// Alias create newID as an alias to distinctID.
+	Alias(ctx context.Context, distinctID, newID string) error
+}
+
+var (
+	_ ProfileSink = (*MixpanelSink)(nil)
+	_ ProfileSink = FanOutSink(nil)
+)
+
+// UpdateProfile apply update using mixpanel engage or groups api.
+func (m *MixpanelSink) UpdateProfile(_ context.Context, update ProfileUpdate) error {
+	if m.token == "" {
+		return errors.WithStack(ErrEmptyToken)
+	}
+
+	u := &mixpanel.Update{
+		IP:         "0",
+		Timestamp:  nil,
+		Operation:  update.Operation,
+		Properties: update.Properties,
+	}
+
+	if update.GroupKey != "" {
+		return errors.WithStack(m.Client.UpdateGroup(update.GroupKey, update.GroupID, u))
+	}
+
+	return errors.WithStack(m.Client.UpdateUser(update.DistinctID, u))
+}
+
+// Alias create newID as an alias to distinctID using mixpanel api.
+func (m *MixpanelSink) Alias(_ context.Context, distinctID, newID string) error {
+	if m.token == "" {
+		return errors.WithStack(ErrEmptyToken)
+	}
+
+	return errors.WithStack(m.Client.Alias(distinctID, newID))
+}
+
+// UpdateProfile apply update at every sink supporting profiles.
+func (f FanOutSink) UpdateProfile(ctx context.Context, update ProfileUpdate) error {
+	return f.eachProfileSink(func(s ProfileSink) error {
+		return s.UpdateProfile(ctx, update)
+	})
+}
+
+// Alias create newID as an alias to distinctID at every sink supporting profiles.
+func (f FanOutSink) Alias(ctx context.Context, distinctID, newID string) error {
+	return f.eachProfileSink(func(s ProfileSink) error {
+		return s.Alias(ctx, distinctID, newID)
+	})
+}
+
+func (f FanOutSink) eachProfileSink(fn func(ProfileSink) error) error {
+	var (
+		err       error
+		supported bool
+	)
+	for _, s := range f {
+		if ps, ok := s.(ProfileSink); ok {
+			supported = true
+			err = multierr.Append(err, fn(ps))
+		}
+	}
+
+	if !supported {
+		return errors.WithStack(ErrProfileUnsupported)
+	}
+
+	return err
+}
+
+// Identify link anonymousID events to distinctID, generally after login.
+func (a *Analytics) Identify(ctx context.Context, distinctID, anonymousID string) {
+	distinctID, anonymousID = a.sanitizeID(distinctID), a.sanitizeID(anonymousID)
+	a.TrackContext(ctx, identifyEvent, map[string]interface{}{
+		"distinctId":         distinctID,
+		propertyIdentifiedID: distinctID,
+		propertyAnonID:       anonymousID,
+	})
+}
+
+// Identify is a wrapper around DefaultClient.Identify.
+func Identify(ctx context.Context, distinctID, anonymousID string) {
+	Default().Identify(ctx, distinctID, anonymousID)
+}
+
+// Alias queue the creation of newID as an alias to distinctID.
+func (a *Analytics) Alias(ctx context.Context, distinctID, newID string) {
+	distinctID, newID = a.sanitizeID(distinctID), a.sanitizeID(newID)
+	event := Event{
+		Name:       aliasEvent,
+		DistinctID: distinctID,
+		Timestamp:  time.Now(),
+		Properties: map[string]interface{}{propertyAlias: newID},
+	}
+	a.submitProfile(ctx, event, func(ps ProfileSink) error {
+		return ps.Alias(context.Background(), distinctID, newID)
+	})
+}
+
+// Alias is a wrapper around DefaultClient.Alias.
+func Alias(ctx context.Context, distinctID, newID string) {
+	Default().Alias(ctx, distinctID, newID)
+}
+
+// SetProfile queue properties to be set at distinctID profile.
+func (a *Analytics) SetProfile(ctx context.Context, distinctID string, properties map[string]interface{}) {
+	a.UpdateProfile(ctx, ProfileUpdate{DistinctID: distinctID, Operation: OperationSet, Properties: properties})
+}
+
+// SetProfile is a wrapper around DefaultClient.SetProfile.
+func SetProfile(ctx context.Context, distinctID string, properties map[string]interface{}) {
+	Default().SetProfile(ctx, distinctID, properties)
+}
+
+// SetOnce queue properties to be set at distinctID profile only if they are
+// not already set.
+func (a *Analytics) SetOnce(ctx context.Context, distinctID string, properties map[string]interface{}) {
+	a.UpdateProfile(ctx, ProfileUpdate{DistinctID: distinctID, Operation: OperationSetOnce, Properties: properties})
+}
+
+// SetOnce is a wrapper around DefaultClient.SetOnce.
+func SetOnce(ctx context.Context, distinctID string, properties map[string]interface{}) {
+	Default().SetOnce(ctx, distinctID, properties)
+}
+
+// Increment queue numeric properties to be added to distinctID profile, use
+// negative values to decrement.
+func (a *Analytics) Increment(ctx context.Context, distinctID string, properties map[string]interface{}) {
+	a.UpdateProfile(ctx, ProfileUpdate{DistinctID: distinctID, Operation: OperationAdd, Properties: properties})
+}
+
+// Increment is a wrapper around DefaultClient.Increment.
+func Increment(ctx context.Context, distinctID string, properties map[string]interface{}) {
+	Default().Increment(ctx, distinctID, properties)
+}
+
+// Union queue list properties to be merged, without duplicates, into distinctID
+// profile.
+func (a *Analytics) Union(ctx context.Context, distinctID string, properties map[string]interface{}) {
+	a.UpdateProfile(ctx, ProfileUpdate{DistinctID: distinctID, Operation: OperationUnion, Properties: properties})
+}
+
+// Union is a wrapper around DefaultClient.Union.
+func Union(ctx context.Context, distinctID string, properties map[string]interface{}) {
+	Default().Union(ctx, distinctID, properties)
+}
+
+// SetGroup queue properties to be set at group profile.
+func (a *Analytics) SetGroup(ctx context.Context, groupKey, groupID string, properties map[string]interface{}) {
+	a.UpdateProfile(ctx, ProfileUpdate{
+		GroupKey:   groupKey,
+		GroupID:    groupID,
+		Operation:  OperationSet,
+		Properties: properties,
+	})
+}
+
+// SetGroup is a wrapper around DefaultClient.SetGroup.
+func SetGroup(ctx context.Context, groupKey, groupID string, properties map[string]interface{}) {
+	Default().SetGroup(ctx, groupKey, groupID, properties)
+}
+
+// SetGroupOnce queue properties to be set at group profile only if they are
+// not already set.
+func (a *Analytics) SetGroupOnce(ctx context.Context, groupKey, groupID string, properties map[string]interface{}) {
+	a.UpdateProfile(ctx, ProfileUpdate{
+		GroupKey:   groupKey,
+		GroupID:    groupID,
+		Operation:  OperationSetOnce,
+		Properties: properties,
+	})
+}
+
+// SetGroupOnce is a wrapper around DefaultClient.SetGroupOnce.
+func SetGroupOnce(ctx context.Context, groupKey, groupID string, properties map[string]interface{}) {
+	Default().SetGroupOnce(ctx, groupKey, groupID, properties)
+}
+
+// UnionGroup queue list properties to be merged, without duplicates, into
+// group profile.
+func (a *Analytics) UnionGroup(ctx context.Context, groupKey, groupID string, properties map[string]interface{}) {
+	a.UpdateProfile(ctx, ProfileUpdate{
+		GroupKey:   groupKey,
+		GroupID:    groupID,
+		Operation:  OperationUnion,
+		Properties: properties,
+	})
+}
+
+// UnionGroup is a wrapper around DefaultClient.UnionGroup.
+func UnionGroup(ctx context.Context, groupKey, groupID string, properties map[string]interface{}) {
+	Default().UnionGroup(ctx, groupKey, groupID, properties)
+}
+
+// UpdateProfile queue update to be applied at user or group profile.
+func (a *Analytics) UpdateProfile(ctx context.Context, update ProfileUpdate) {
+	sanitized := a.sanitize(update.Properties)
+	if update.Operation == OperationAdd {
+		// increments must stay numbers, hashing or masking them makes the update invalid.
+		for k, v := range update.Properties {
+			if _, ok := sanitized[k]; ok && isNumber(v) {
+				sanitized[k] = v
+			}
+		}
+	}
+	update.Properties = sanitized
+	update.DistinctID = a.sanitizeID(update.DistinctID)
+	update.GroupID = a.sanitizeID(update.GroupID)
+
+	a.submitProfile(ctx, update.event(), func(ps ProfileSink) error {
+		return ps.UpdateProfile(context.Background(), update)
+	})
+}
+
+// UpdateProfile is a wrapper around DefaultClient.UpdateProfile.
+func UpdateProfile(ctx context.Context, update ProfileUpdate) {
+	Default().UpdateProfile(ctx, update)
+}
+
+// submitProfile run fn at worker pool using retry policy, failures are logged
+// and event, describing the operation, is sent to dead letter.
+func (a *Analytics) submitProfile(ctx context.Context, event Event, fn func(ProfileSink) error) {
+	a.initDefault()
+
+	if a.queueFull() {
+		err := errors.WithStack(ErrQueueFull)
+		a.Logger.Error(ctx, "Error queueing profile operation", log.Any("operation", event.Name), log.Error(err))
+		a.toDeadLetter(err, event)
+
+		return
+	}
+
+	a.wp.Submit(func() {
+		err := a.retryPolicy.do(context.Background(), func() error {
+			ps, ok := a.sink().(ProfileSink)
+			if !ok {
+				return errors.WithStack(ErrProfileUnsupported)
+			}
+
+			return fn(ps)
+		})
+		if err != nil {
+			a.Logger.Error(ctx, "Error sending profile operation to sink", log.Any("operation", event.Name), log.Error(err))
+			a.toDeadLetter(err, event)
+		}
+	})
+}
+
+// event describes update to dead letter.
+func (u ProfileUpdate) event() Event {
+	props := make(map[string]interface{}, len(u.Properties)+2)
+	for k, v := range u.Properties {
+		props[k] = v
+	}
+	if u.GroupKey != "" {
+		props[propertyGroupKey] = u.GroupKey
+		props[propertyGroupID] = u.GroupID
+	}
+
+	return Event{
+		Name:       u.Operation,
+		DistinctID: u.DistinctID,
+		Timestamp:  time.Now(),
+		Properties: props,
+	}
+}
+
+func isNumber(v interface{}) bool {
+	switch reflect.ValueOf(v).Kind() { //nolint:exhaustive // other kinds are not numbers.
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,301 @@
+//nolint:revive,stylecheck // yeah mixpanel use bad names
+package analytics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dukex/mixpanel"
+	"github.com/facily-tech/go-core/log"
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type profileRecorder struct {
+	sinkFunc
+	updates chan ProfileUpdate
+	aliases chan [2]string
+}
+
+func newProfileRecorder() *profileRecorder {
+	return &profileRecorder{
+		sinkFunc: func(ctx context.Context, event Event) error { return nil },
+		updates:  make(chan ProfileUpdate, 1),
+		aliases:  make(chan [2]string, 1),
+	}
+}
+
+func (p *profileRecorder) UpdateProfile(_ context.Context, update ProfileUpdate) error {
+	p.updates <- update
+
+	return nil
+}
+
+func (p *profileRecorder) Alias(_ context.Context, distinctID, newID string) error {
+	p.aliases <- [2]string{distinctID, newID}
+
+	return nil
+}
+
+func TestAnalytics_UpdateProfile(t *testing.T) {
+	props := map[string]interface{}{"plan": "gold"}
+
+	tests := []struct {
+		name string
+		call func(a *Analytics)
+		want ProfileUpdate
+	}{
+		{
+			name: "set",
+			call: func(a *Analytics) { a.SetProfile(context.Background(), "123", props) },
+			want: ProfileUpdate{DistinctID: "123", Operation: OperationSet, Properties: props},
+		},
+		{
+			name: "set once",
+			call: func(a *Analytics) { a.SetOnce(context.Background(), "123", props) },
+			want: ProfileUpdate{DistinctID: "123", Operation: OperationSetOnce, Properties: props},
+		},
+		{
+			name: "increment",
+			call: func(a *Analytics) { a.Increment(context.Background(), "123", props) },
+			want: ProfileUpdate{DistinctID: "123", Operation: OperationAdd, Properties: props},
+		},
+		{
+			name: "union",
+			call: func(a *Analytics) { a.Union(context.Background(), "123", props) },
+			want: ProfileUpdate{DistinctID: "123", Operation: OperationUnion, Properties: props},
+		},
+		{
+			name: "set group",
+			call: func(a *Analytics) { a.SetGroup(context.Background(), "company", "facily", props) },
+			want: ProfileUpdate{GroupKey: "company", GroupID: "facily", Operation: OperationSet, Properties: props},
+		},
+		{
+			name: "set group once",
+			call: func(a *Analytics) { a.SetGroupOnce(context.Background(), "company", "facily", props) },
+			want: ProfileUpdate{GroupKey: "company", GroupID: "facily", Operation: OperationSetOnce, Properties: props},
+		},
+		{
+			name: "union group",
+			call: func(a *Analytics) { a.UnionGroup(context.Background(), "company", "facily", props) },
+			want: ProfileUpdate{GroupKey: "company", GroupID: "facily", Operation: OperationUnion, Properties: props},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := newProfileRecorder()
+			//nolint:exhaustruct // accept default values at structs
+			a := &Analytics{Sink: sink, Logger: log.NewMockLogger(gomock.NewController(t))}
+			a.WithWorkerPool(1)
+
+			tt.call(a)
+
+			select {
+			case <-time.After(time.Minute):
+				t.Error("UpdateProfile timeout")
+			case got := <-sink.updates:
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAnalytics_Alias(t *testing.T) {
+	sink := newProfileRecorder()
+	//nolint:exhaustruct // accept default values at structs
+	a := &Analytics{Sink: sink, Logger: log.NewMockLogger(gomock.NewController(t))}
+	a.WithWorkerPool(1)
+
+	a.Alias(context.Background(), "123", "user@facily.com.br")
+
+	select {
+	case <-time.After(time.Minute):
+		t.Error("Alias timeout")
+	case got := <-sink.aliases:
+		assert.Equal(t, [2]string{"123", "user@facily.com.br"}, got)
+	}
+}
+
+func TestAnalytics_Identify(t *testing.T) {
+	events := make(chan Event, 1)
+	//nolint:exhaustruct // accept default values at structs
+	a := &Analytics{
+		Sink: sinkFunc(func(ctx context.Context, event Event) error {
+			events <- event
+
+			return nil
+		}),
+		Logger: log.NewMockLogger(gomock.NewController(t)),
+	}
+	a.WithWorkerPool(1)
+
+	a.Identify(context.Background(), "123", "anon")
+
+	select {
+	case <-time.After(time.Minute):
+		t.Error("Identify timeout")
+	case got := <-events:
+		assert.Equal(t, identifyEvent, got.Name)
+		assert.Equal(t, "123", got.DistinctID)
+		assert.Equal(t, "123", got.Properties[propertyIdentifiedID])
+		assert.Equal(t, "anon", got.Properties[propertyAnonID])
+	}
+}
+
+func TestAnalytics_UpdateProfile_retry(t *testing.T) {
+	attempts := 0
+	done := make(chan struct{})
+	//nolint:exhaustruct // accept default values at structs
+	sink := &MixpanelSink{
+		Client: &MixMock{
+			updateUserF: func(distinctId string, u *mixpanel.Update) error {
+				attempts++
+				if attempts == 1 {
+					return context.DeadlineExceeded
+				}
+				close(done)
+
+				return nil
+			},
+		},
+		token: "token",
+	}
+	//nolint:exhaustruct // accept default values at structs
+	a := &Analytics{Sink: sink, Logger: log.NewMockLogger(gomock.NewController(t))}
+	a.WithWorkerPool(1)
+	a.WithRetry(RetryPolicy{Attempts: 2, InitialBackoff: time.Millisecond})
+
+	a.SetProfile(context.Background(), "123", map[string]interface{}{"plan": "gold"})
+
+	select {
+	case <-time.After(time.Minute):
+		t.Error("SetProfile timeout")
+	case <-done:
+	}
+	a.Close()
+	assert.Equal(t, 2, attempts)
+}
+
+func TestAnalytics_UpdateProfile_unsupported(t *testing.T) {
+	logger := log.NewMockLogger(gomock.NewController(t))
+	logger.EXPECT().Error(gomock.Any(), gomock.Any(), gomock.Any())
+	//nolint:exhaustruct // accept default values at structs
+	a := &Analytics{
+		Sink:   sinkFunc(func(ctx context.Context, event Event) error { return nil }),
+		Logger: logger,
+	}
+	a.WithWorkerPool(1)
+
+	deadLetter := make(chan Event, 1)
+	a.WithDeadLetter(func(event Event, err error) {
+		assert.ErrorIs(t, err, ErrProfileUnsupported)
+		deadLetter <- event
+	})
+
+	a.SetGroup(context.Background(), "company", "facily", map[string]interface{}{"plan": "gold"})
+
+	select {
+	case <-time.After(time.Minute):
+		t.Error("dead letter timeout")
+	case got := <-deadLetter:
+		assert.Equal(t, OperationSet, got.Name)
+		assert.Equal(t, map[string]interface{}{
+			"plan":           "gold",
+			propertyGroupKey: "company",
+			propertyGroupID:  "facily",
+		}, got.Properties)
+	}
+}
+
+func TestAnalytics_Increment_sanitized(t *testing.T) {
+	sink := newProfileRecorder()
+	//nolint:exhaustruct // accept default values at structs
+	a := &Analytics{Sink: sink, Logger: log.NewMockLogger(gomock.NewController(t))}
+	a.WithWorkerPool(1)
+	//nolint:exhaustruct // accept default values at structs
+	a.WithSanitizer(SanitizePolicy{Keys: map[string]SanitizeAction{"purchases": SanitizeHash, "email": SanitizeHash}})
+
+	a.Increment(context.Background(), "123", map[string]interface{}{"purchases": 1, "email": "user@facily.com.br"})
+
+	select {
+	case <-time.After(time.Minute):
+		t.Error("Increment timeout")
+	case got := <-sink.updates:
+		assert.Equal(t, 1, got.Properties["purchases"])
+		assert.NotEqual(t, "user@facily.com.br", got.Properties["email"])
+	}
+}
+
+func TestMixpanelSink_UpdateProfile(t *testing.T) {
+	t.Run("user", func(t *testing.T) {
+		var got *mixpanel.Update
+		//nolint:exhaustruct // accept default values at structs
+		s := &MixpanelSink{
+			Client: &MixMock{
+				updateUserF: func(distinctId string, u *mixpanel.Update) error {
+					assert.Equal(t, "123", distinctId)
+					got = u
+
+					return nil
+				},
+			},
+			token: "token",
+		}
+
+		err := s.UpdateProfile(context.Background(), ProfileUpdate{
+			DistinctID: "123",
+			Operation:  OperationAdd,
+			Properties: map[string]interface{}{"purchases": 1},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, OperationAdd, got.Operation)
+		assert.Equal(t, map[string]interface{}{"purchases": 1}, got.Properties)
+	})
+	t.Run("group", func(t *testing.T) {
+		//nolint:exhaustruct // accept default values at structs
+		s := &MixpanelSink{
+			Client: &MixMock{
+				updateGroupF: func(groupKey, groupId string, u *mixpanel.Update) error {
+					assert.Equal(t, "company", groupKey)
+					assert.Equal(t, "facily", groupId)
+
+					return errors.New("random error")
+				},
+			},
+			token: "token",
+		}
+
+		err := s.UpdateProfile(context.Background(), ProfileUpdate{
+			GroupKey:   "company",
+			GroupID:    "facily",
+			Operation:  OperationSet,
+			Properties: nil,
+		})
+		assert.Error(t, err)
+	})
+	t.Run("no token", func(t *testing.T) {
+		//nolint:exhaustruct // accept default values at structs
+		s := &MixpanelSink{Client: &MixMock{}}
+
+		assert.ErrorIs(t, s.UpdateProfile(context.Background(), ProfileUpdate{}), ErrEmptyToken)
+		assert.ErrorIs(t, s.Alias(context.Background(), "123", "456"), ErrEmptyToken)
+	})
+}
+
+func TestFanOutSink_UpdateProfile(t *testing.T) {
+	t.Run("only profile sinks", func(t *testing.T) {
+		profile := newProfileRecorder()
+		s := NewFanOutSink(sinkFunc(func(ctx context.Context, event Event) error { return nil }), profile)
+
+		assert.NoError(t, s.UpdateProfile(context.Background(), ProfileUpdate{DistinctID: "123"}))
+		assert.Equal(t, "123", (<-profile.updates).DistinctID)
+	})
+	t.Run("unsupported", func(t *testing.T) {
+		s := NewFanOutSink(sinkFunc(func(ctx context.Context, event Event) error { return nil }))
+
+		assert.ErrorIs(t, s.UpdateProfile(context.Background(), ProfileUpdate{}), ErrProfileUnsupported)
+		assert.ErrorIs(t, s.Alias(context.Background(), "123", "456"), ErrProfileUnsupported)
+	})
+}
@@ -0,0 +1,217 @@
+package analytics
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/dukex/mixpanel"
+	"github.com/facily-tech/go-core/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultRetryInitialBackoff = 100 * time.Millisecond
+	defaultRetryMaxBackoff     = 10 * time.Second
+)
+
+// mixpanelHTTPCode extract http status code from mixpanel.ErrTrackFailed message.
+var mixpanelHTTPCode = regexp.MustCompile(`httpCode=(\d+)`)
+
+// DeadLetterFunc receive events which could not be delivered after every retry.
+type DeadLetterFunc func(event Event, err error)
+
+// RetryPolicy controls how many times and how often failed deliveries are
+// retried. The zero value makes a single attempt.
+type RetryPolicy struct {
+	// Attempts is the maximum number of deliveries, including the first one.
+	Attempts int
+	// InitialBackoff is the wait after the first failure, doubled after each
+	// attempt, default 100ms.
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum wait between attempts, default 10s.
+	MaxBackoff time.Duration
+	// Jitter randomize each wait by up to this fraction (0 to 1) of it.
+	Jitter float64
+	// Retryable classify errors worth retrying, default IsRetryable.
+	Retryable func(error) bool
+}
+
+// IsRetryable returns true for errors which may succeed if retried: network
+// errors, timeouts, http 429 and 5xx.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return retryableStatus(statusErr.StatusCode)
+	}
+
+	var mixpanelErr *mixpanel.MixpanelError
+	if errors.As(err, &mixpanelErr) {
+		// mixpanel package do not implement Unwrap, Err is either a track failure
+		// or a http client error.
+		var trackErr *mixpanel.ErrTrackFailed
+		if errors.As(mixpanelErr.Err, &trackErr) {
+			match := mixpanelHTTPCode.FindStringSubmatch(trackErr.Message)
+			if match == nil {
+				return false
+			}
+			code, err := strconv.Atoi(match[1])
+
+			return err == nil && retryableStatus(code)
+		}
+
+		return true
+	}
+
+	return false
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+
+	return IsRetryable(err)
+}
+
+// backoff returns how long to wait before the attempt+1.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	initial := p.InitialBackoff
+	if initial <= 0 {
+		initial = defaultRetryInitialBackoff
+	}
+	maxBackoff := p.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultRetryMaxBackoff
+	}
+
+	d := initial
+	for i := 1; i < attempt && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+
+	if p.Jitter > 0 {
+		//nolint:gosec // jitter do not require secure random numbers.
+		d += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(d))
+	}
+
+	return d
+}
+
+// do call fn until it succeeds, returns a non retryable error, attempts are
+// exhausted or ctx is done.
+func (p RetryPolicy) do(ctx context.Context, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= p.Attempts || !p.retryable(err) {
+			return err
+		}
+
+		t := time.NewTimer(p.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+
+			return err
+		case <-t.C:
+		}
+	}
+}
+
+// WithRetry set the policy applied when delivering events.
+
+// WithRetry is a wrapper around DefaultClient.WithRetry.
+func WithRetry(policy RetryPolicy) {
+	Default().WithRetry(policy)
+}
+
+// WithRetry set the policy applied when delivering events.
+func (a *Analytics) WithRetry(policy RetryPolicy) {
+	a.retryPolicy = policy
+}
+
+// WithDeadLetter set a function to receive events sent by Track which could
+// not be delivered, even after retries.
+
+// WithDeadLetter is a wrapper around DefaultClient.WithDeadLetter.
+func WithDeadLetter(deadLetter DeadLetterFunc) {
+	Default().WithDeadLetter(deadLetter)
+}
+
+// WithDeadLetter set a function to receive events sent by Track which could
+// not be delivered, even after retries. Failed profile operations are received
+// as events named after the operation, like "$set" or "$create_alias".
+func (a *Analytics) WithDeadLetter(deadLetter DeadLetterFunc) {
+	a.deadLetter = deadLetter
+}
+
+func (a *Analytics) deliver(ctx context.Context, event Event) error {
+	return a.retryPolicy.do(ctx, func() error {
+		return a.send(ctx, event)
+	})
+}
+
+// deliverBatch retries only events not delivered by the previous attempt.
+func (a *Analytics) deliverBatch(ctx context.Context, events []Event) error {
+	pending := events
+
+	return a.retryPolicy.do(ctx, func() error {
+		err := a.sendBatch(ctx, pending)
+		pending = undelivered(err, pending)
+
+		return err
+	})
+}
+
+// deliverSpool is used by spool, retryable errors are returned so events are
+// kept on disk, other errors send events to dead letter.
+func (a *Analytics) deliverSpool(ctx context.Context, events []Event) error {
+	err := a.deliverBatch(ctx, events)
+	if err == nil || a.retryPolicy.retryable(err) {
+		return err
+	}
+
+	failed := undelivered(err, events)
+	a.Logger.Error(ctx, "Error sending spool events to sink, discarding", log.Any("size", len(failed)), log.Error(err))
+	a.toDeadLetter(err, failed...)
+
+	return nil
+}
+
+func (a *Analytics) toDeadLetter(err error, events ...Event) {
+	if a.deadLetter == nil {
+		return
+	}
+
+	for _, e := range events {
+		a.deadLetter(e, err)
+	}
+}
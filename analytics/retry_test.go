@@ -0,0 +1,184 @@
+package analytics
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dukex/mixpanel"
+	"github.com/facily-tech/go-core/log"
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "nil",
+			err:  nil,
+			want: false,
+		},
+		{
+			name: "too many requests",
+			err:  errors.WithStack(&StatusError{StatusCode: http.StatusTooManyRequests}),
+			want: true,
+		},
+		{
+			name: "server error",
+			err:  errors.WithStack(&StatusError{StatusCode: http.StatusBadGateway}),
+			want: true,
+		},
+		{
+			name: "bad request",
+			err:  errors.WithStack(&StatusError{StatusCode: http.StatusBadRequest}),
+			want: false,
+		},
+		{
+			name: "network error",
+			err:  errors.WithStack(&net.OpError{Op: "dial", Err: errors.New("connection refused")}),
+			want: true,
+		},
+		{
+			name: "timeout",
+			err:  errors.WithStack(context.DeadlineExceeded),
+			want: true,
+		},
+		{
+			name: "mixpanel server error",
+			err: errors.WithStack(&mixpanel.MixpanelError{
+				Err: &mixpanel.ErrTrackFailed{Message: "error=; status=0; httpCode=503"},
+			}),
+			want: true,
+		},
+		{
+			name: "mixpanel invalid event",
+			err: errors.WithStack(&mixpanel.MixpanelError{
+				Err: &mixpanel.ErrTrackFailed{Message: "error=invalid; status=0; httpCode=400"},
+			}),
+			want: false,
+		},
+		{
+			name: "empty token",
+			err:  errors.WithStack(ErrEmptyToken),
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsRetryable(tt.err))
+		})
+	}
+}
+
+func TestRetryPolicy_do(t *testing.T) {
+	retryable := errors.WithStack(&StatusError{StatusCode: http.StatusServiceUnavailable})
+	permanent := errors.WithStack(&StatusError{StatusCode: http.StatusBadRequest})
+
+	tests := []struct {
+		name      string
+		policy    RetryPolicy
+		errs      []error
+		wantCalls int
+		wantErr   error
+	}{
+		{
+			name:      "zero value makes a single attempt",
+			policy:    RetryPolicy{},
+			errs:      []error{retryable, nil},
+			wantCalls: 1,
+			wantErr:   retryable,
+		},
+		{
+			name:      "retry until success",
+			policy:    RetryPolicy{Attempts: 3, InitialBackoff: time.Millisecond},
+			errs:      []error{retryable, retryable, nil},
+			wantCalls: 3,
+			wantErr:   nil,
+		},
+		{
+			name:      "stop when attempts are exhausted",
+			policy:    RetryPolicy{Attempts: 2, InitialBackoff: time.Millisecond, Jitter: 0.5},
+			errs:      []error{retryable, retryable, nil},
+			wantCalls: 2,
+			wantErr:   retryable,
+		},
+		{
+			name:      "do not retry permanent errors",
+			policy:    RetryPolicy{Attempts: 3, InitialBackoff: time.Millisecond},
+			errs:      []error{permanent, nil},
+			wantCalls: 1,
+			wantErr:   permanent,
+		},
+		{
+			name: "custom classification",
+			policy: RetryPolicy{
+				Attempts:       3,
+				InitialBackoff: time.Millisecond,
+				Retryable:      func(error) bool { return true },
+			},
+			errs:      []error{permanent, nil},
+			wantCalls: 2,
+			wantErr:   nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := tt.policy.do(context.Background(), func() error {
+				calls++
+
+				return tt.errs[calls-1]
+			})
+
+			assert.Equal(t, tt.wantCalls, calls)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 3 * time.Second}
+
+	assert.Equal(t, time.Second, p.backoff(1))
+	assert.Equal(t, 2*time.Second, p.backoff(2))
+	assert.Equal(t, 3*time.Second, p.backoff(3))
+	assert.Equal(t, 3*time.Second, p.backoff(10))
+}
+
+func TestAnalytics_WithDeadLetter(t *testing.T) {
+	logger := log.NewMockLogger(gomock.NewController(t))
+	logger.EXPECT().Error(gomock.Any(), gomock.Any(), gomock.Any()).Times(1)
+
+	sendErr := errors.WithStack(&StatusError{StatusCode: http.StatusServiceUnavailable})
+	calls := 0
+	a := &Analytics{
+		Sink: sinkFunc(func(ctx context.Context, event Event) error {
+			calls++
+
+			return sendErr
+		}),
+		Logger: logger,
+	}
+	a.WithWorkerPool(1)
+	a.WithRetry(RetryPolicy{Attempts: 3, InitialBackoff: time.Millisecond})
+
+	var dead []Event
+	a.WithDeadLetter(func(event Event, err error) {
+		assert.Equal(t, sendErr, err)
+		dead = append(dead, event)
+	})
+
+	a.Track("eventName", map[string]interface{}{"propertie": "value"})
+	a.Close()
+
+	assert.Equal(t, 3, calls)
+	assert.Len(t, dead, 1)
+	assert.Equal(t, "eventName", dead[0].Name)
+}
@@ -0,0 +1,134 @@
+package analytics
+
+import (
+	"math/rand"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+)
+
+// PropertySampledOut is the amount of events with the same name discarded by
+// sampling or rate limit since the previous kept one, use it to re-weight.
+const PropertySampledOut = "sampledOut"
+
+// ErrQueueFull error when an event is dropped because worker pool queue is
+// full, see WithBackpressure.
+var ErrQueueFull = errors.New("analytics queue is full")
+
+// SamplingRule controls how many events with the same name are kept.
+type SamplingRule struct {
+	// Rate is the fraction, between 0 and 1, of events kept, see SampleRate.
+	// Nil keeps every event and zero discards every event.
+	Rate *float64
+	// Limit is the maximum amount of kept events per second, using a token
+	// bucket. Zero means no limit.
+	Limit float64
+	// Burst is the bucket size, default is Limit rounded up.
+	Burst int
+}
+
+// SampleRate returns rate as a SamplingRule.Rate.
+func SampleRate(rate float64) *float64 {
+	return &rate
+}
+
+type sampler struct {
+	rate    *float64
+	limiter *rate.Limiter
+
+	mu      sync.Mutex
+	dropped int
+}
+
+func newSampler(rule SamplingRule) *sampler {
+	s := &sampler{rate: rule.Rate, limiter: nil, mu: sync.Mutex{}, dropped: 0}
+	if rule.Limit > 0 {
+		burst := rule.Burst
+		if burst <= 0 {
+			burst = int(rule.Limit)
+			if float64(burst) < rule.Limit {
+				burst++
+			}
+		}
+		s.limiter = rate.NewLimiter(rate.Limit(rule.Limit), burst)
+	}
+
+	return s
+}
+
+// keep returns if an event should be kept and, if so, how many were dropped
+// before it.
+func (s *sampler) keep() (bool, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	//nolint:gosec // sampling do not require secure random numbers.
+	if (s.rate != nil && rand.Float64() >= *s.rate) || (s.limiter != nil && !s.limiter.Allow()) {
+		s.dropped++
+
+		return false, 0
+	}
+
+	dropped := s.dropped
+	s.dropped = 0
+
+	return true, dropped
+}
+
+// WithSampling set sampling rules by event name, events without a rule are
+// always kept. Kept events receive the sampledOut property.
+
+// WithSampling is a wrapper around DefaultClient.WithSampling.
+func WithSampling(rules map[string]SamplingRule) {
+	Default().WithSampling(rules)
+}
+
+// WithSampling set sampling rules by event name, events without a rule are
+// always kept. Kept events receive the sampledOut property.
+func (a *Analytics) WithSampling(rules map[string]SamplingRule) {
+	a.samplers = make(map[string]*sampler, len(rules))
+	for name, rule := range rules {
+		a.samplers[name] = newSampler(rule)
+	}
+}
+
+// sample returns false if event must be discarded.
+func (a *Analytics) sample(event *Event) bool {
+	s, ok := a.samplers[event.Name]
+	if !ok {
+		return true
+	}
+
+	kept, dropped := s.keep()
+	if !kept {
+		return false
+	}
+
+	if event.Properties == nil {
+		event.Properties = make(map[string]interface{})
+	}
+	event.Properties[PropertySampledOut] = dropped
+
+	return true
+}
+
+// WithBackpressure makes Track and profile operations drop, instead of queue,
+// when maxQueue tasks are already waiting for a worker. Dropped events are
+// sent to dead letter with ErrQueueFull. Zero disables it.
+
+// WithBackpressure is a wrapper around DefaultClient.WithBackpressure.
+func WithBackpressure(maxQueue int) {
+	Default().WithBackpressure(maxQueue)
+}
+
+// WithBackpressure makes Track and profile operations drop, instead of queue,
+// when maxQueue tasks are already waiting for a worker. Dropped events are
+// sent to dead letter with ErrQueueFull. Zero disables it.
+func (a *Analytics) WithBackpressure(maxQueue int) {
+	a.maxQueue = maxQueue
+}
+
+func (a *Analytics) queueFull() bool {
+	return a.maxQueue > 0 && a.wp.WaitingQueueSize() >= a.maxQueue
+}
@@ -0,0 +1,155 @@
+package analytics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/facily-tech/go-core/log"
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+type blockedPool struct {
+	waiting int
+}
+
+func (p *blockedPool) StopWait() {}
+
+func (p *blockedPool) Submit(func()) { p.waiting++ }
+
+func (p *blockedPool) WaitingQueueSize() int { return p.waiting }
+
+func TestSampler_keep(t *testing.T) {
+	tests := []struct {
+		name        string
+		rule        SamplingRule
+		events      int
+		wantKept    int
+		wantDropped []int
+	}{
+		{
+			name:        "no sampling",
+			rule:        SamplingRule{},
+			events:      3,
+			wantKept:    3,
+			wantDropped: []int{0, 0, 0},
+		},
+		{
+			name:        "rate limit",
+			rule:        SamplingRule{Limit: 0.001, Burst: 2},
+			events:      5,
+			wantKept:    2,
+			wantDropped: []int{0, 0},
+		},
+		{
+			name:        "sampling rate",
+			rule:        SamplingRule{Rate: SampleRate(0.000001)},
+			events:      100,
+			wantKept:    0,
+			wantDropped: nil,
+		},
+		{
+			name:        "zero rate",
+			rule:        SamplingRule{Rate: SampleRate(0)},
+			events:      100,
+			wantKept:    0,
+			wantDropped: nil,
+		},
+		{
+			name:        "full rate",
+			rule:        SamplingRule{Rate: SampleRate(1)},
+			events:      3,
+			wantKept:    3,
+			wantDropped: []int{0, 0, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSampler(tt.rule)
+
+			var dropped []int
+			for i := 0; i < tt.events; i++ {
+				if kept, d := s.keep(); kept {
+					dropped = append(dropped, d)
+				}
+			}
+
+			assert.Len(t, dropped, tt.wantKept)
+			assert.Equal(t, tt.wantDropped, dropped)
+		})
+	}
+}
+
+func TestSampler_keep_countDropped(t *testing.T) {
+	s := newSampler(SamplingRule{Limit: 0.001, Burst: 1})
+
+	kept, _ := s.keep()
+	assert.True(t, kept)
+	for i := 0; i < 3; i++ {
+		kept, _ = s.keep()
+		assert.False(t, kept)
+	}
+
+	s.limiter.SetLimit(rate.Inf)
+	kept, dropped := s.keep()
+	assert.True(t, kept)
+	assert.Equal(t, 3, dropped)
+}
+
+func TestAnalytics_WithSampling(t *testing.T) {
+	var got []Event
+	//nolint:exhaustruct // accept default values at structs
+	a := &Analytics{
+		Sink: sinkFunc(func(ctx context.Context, event Event) error {
+			got = append(got, event)
+
+			return nil
+		}),
+		Logger: log.NewMockLogger(gomock.NewController(t)),
+	}
+	a.WithSampling(map[string]SamplingRule{"pageView": {Limit: 0.001, Burst: 1}})
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, a.TrackSync("pageView", nil))
+		assert.NoError(t, a.TrackSync("purchase", nil))
+	}
+
+	assert.Len(t, got, 4)
+	assert.Equal(t, "pageView", got[0].Name)
+	assert.Equal(t, 0, got[0].Properties[PropertySampledOut])
+	for _, e := range got[1:] {
+		assert.Equal(t, "purchase", e.Name)
+		assert.NotContains(t, e.Properties, PropertySampledOut)
+	}
+}
+
+func TestAnalytics_WithBackpressure(t *testing.T) {
+	var deadLetter []error
+	pool := &blockedPool{}
+	logger := log.NewMockLogger(gomock.NewController(t))
+	logger.EXPECT().Error(gomock.Any(), gomock.Any(), gomock.Any()).Times(1)
+	//nolint:exhaustruct // accept default values at structs
+	a := &Analytics{
+		Sink:   sinkFunc(func(ctx context.Context, event Event) error { return nil }),
+		Logger: logger,
+		wp:     pool,
+	}
+	a.WithBackpressure(2)
+	a.WithDeadLetter(func(event Event, err error) {
+		deadLetter = append(deadLetter, err)
+	})
+
+	for i := 0; i < 3; i++ {
+		a.Track("eventName", nil)
+	}
+	a.SetProfile(context.Background(), "123", nil)
+
+	assert.Equal(t, 2, pool.waiting)
+	// the third event and the profile operation.
+	assert.Len(t, deadLetter, 2)
+	for _, err := range deadLetter {
+		assert.True(t, errors.Is(err, ErrQueueFull))
+	}
+}
@@ -0,0 +1,238 @@
+package analytics
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// SanitizeAction is what is done with a sensitive property.
+type SanitizeAction int
+
+const (
+	// SanitizeKeep send value unchanged.
+	SanitizeKeep SanitizeAction = iota
+	// SanitizeMask replace value by a masked version, emails and phones are
+	// masked by SanitizePolicy.Masker, other values are replaced by maskedValue.
+	SanitizeMask
+	// SanitizeHash replace value by its HMAC-SHA256 using SanitizePolicy.Salt,
+	// keeping it useful to count and join.
+	SanitizeHash
+	// SanitizeDrop remove property.
+	SanitizeDrop
+)
+
+const maskedValue = "***"
+
+var (
+	emailPattern = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+	phonePattern = regexp.MustCompile(`^\+?[\d\s().-]+$`)
+	nonDigit     = regexp.MustCompile(`\D`)
+)
+
+// minPhoneDigits avoid treating small numbers, like "2021", as phones.
+const minPhoneDigits = 10
+
+// Masker mask emails and phones. It has the methods of masketeer.IMasketeer,
+// which is not imported to keep masketeer optional, so any IMasketeer, like
+// masketeer.New(nil), is a Masker.
+type Masker interface {
+	Email(eml string) string
+	Phone(pho string) string
+}
+
+// SanitizePolicy configure how sensitive properties are handled before
+// dispatch.
+type SanitizePolicy struct {
+	// Masker used by SanitizeMask on emails and phones, generally
+	// masketeer.New(nil).
+	Masker Masker
+	// Keys maps property names, case insensitive and at any depth, to the
+	// action applied to their values.
+	Keys map[string]SanitizeAction
+	// Emails is the action applied to string values which look like an email.
+	Emails SanitizeAction
+	// Phones is the action applied to string values which look like a phone.
+	Phones SanitizeAction
+	// Salt is the HMAC key used by SanitizeHash.
+	Salt string
+}
+
+// DefaultSanitizePolicy masks emails and phones, hashes documents and drops
+// credentials.
+func DefaultSanitizePolicy(masker Masker, salt string) SanitizePolicy {
+	return SanitizePolicy{
+		Masker: masker,
+		Keys: map[string]SanitizeAction{
+			"cpf":           SanitizeHash,
+			"cnpj":          SanitizeHash,
+			"password":      SanitizeDrop,
+			"senha":         SanitizeDrop,
+			"token":         SanitizeDrop,
+			"accessToken":   SanitizeDrop,
+			"refreshToken":  SanitizeDrop,
+			"secret":        SanitizeDrop,
+			"authorization": SanitizeDrop,
+		},
+		Emails: SanitizeMask,
+		Phones: SanitizeMask,
+		Salt:   salt,
+	}
+}
+
+// Sanitize returns a copy of properties with policy applied, properties is
+// not changed.
+func (p SanitizePolicy) Sanitize(properties map[string]interface{}) map[string]interface{} {
+	if properties == nil {
+		return nil
+	}
+
+	sanitized := make(map[string]interface{}, len(properties))
+	for k, v := range properties {
+		action, ok := p.keyAction(k)
+		if !ok {
+			sanitized[k] = p.sanitizeValue(v)
+
+			continue
+		}
+
+		if action == SanitizeDrop {
+			continue
+		}
+		sanitized[k] = p.apply(action, v)
+	}
+
+	return sanitized
+}
+
+func (p SanitizePolicy) keyAction(key string) (SanitizeAction, bool) {
+	if action, ok := p.Keys[key]; ok {
+		return action, true
+	}
+	for k, action := range p.Keys {
+		if strings.EqualFold(k, key) {
+			return action, true
+		}
+	}
+
+	return SanitizeKeep, false
+}
+
+// sanitizeValue apply content based rules to v, looking inside maps and slices.
+func (p SanitizePolicy) sanitizeValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case string:
+		switch {
+		case p.Emails != SanitizeKeep && emailPattern.MatchString(value):
+			return p.apply(p.Emails, value)
+		case p.Phones != SanitizeKeep && isPhone(value):
+			return p.apply(p.Phones, value)
+		}
+	case map[string]interface{}:
+		return p.Sanitize(value)
+	case []interface{}:
+		sanitized := make([]interface{}, 0, len(value))
+		for _, item := range value {
+			sanitized = append(sanitized, p.sanitizeValue(item))
+		}
+
+		return sanitized
+	case []string:
+		sanitized := make([]interface{}, 0, len(value))
+		for _, item := range value {
+			sanitized = append(sanitized, p.sanitizeValue(item))
+		}
+
+		return sanitized
+	}
+
+	return v
+}
+
+// apply action to v, dropped values inside slices became nil.
+func (p SanitizePolicy) apply(action SanitizeAction, v interface{}) interface{} {
+	switch action {
+	case SanitizeKeep:
+		return v
+	case SanitizeMask:
+		return p.mask(v)
+	case SanitizeHash:
+		return p.hash(v)
+	case SanitizeDrop:
+		return nil
+	}
+
+	return v
+}
+
+func (p SanitizePolicy) hash(v interface{}) string {
+	mac := hmac.New(sha256.New, []byte(p.Salt))
+	_, _ = mac.Write([]byte(fmt.Sprint(v)))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SanitizeID returns id hashed if it's an email or phone not kept by policy.
+// Ids are never masked or dropped, it would merge different users.
+func (p SanitizePolicy) SanitizeID(id string) string {
+	if p.Emails != SanitizeKeep && emailPattern.MatchString(id) ||
+		p.Phones != SanitizeKeep && isPhone(id) {
+		return p.hash(id)
+	}
+
+	return id
+}
+
+func (p SanitizePolicy) mask(v interface{}) interface{} {
+	s, ok := v.(string)
+	if !ok || p.Masker == nil {
+		return maskedValue
+	}
+
+	switch {
+	case emailPattern.MatchString(s):
+		return p.Masker.Email(s)
+	case isPhone(s):
+		return p.Masker.Phone(s)
+	}
+
+	return maskedValue
+}
+
+func isPhone(s string) bool {
+	return phonePattern.MatchString(s) && len(nonDigit.ReplaceAllString(s, "")) >= minPhoneDigits
+}
+
+// WithSanitizer set policy applied to properties of events and profile
+// updates before dispatch.
+
+// WithSanitizer is a wrapper around DefaultClient.WithSanitizer.
+func WithSanitizer(policy SanitizePolicy) {
+	Default().WithSanitizer(policy)
+}
+
+// WithSanitizer set policy applied to properties of events and profile
+// updates before dispatch, distinct ids, aliases and group ids are sanitized
+// by SanitizePolicy.SanitizeID.
+func (a *Analytics) WithSanitizer(policy SanitizePolicy) {
+	a.sanitizer = &policy
+}
+
+func (a *Analytics) sanitize(properties map[string]interface{}) map[string]interface{} {
+	if a.sanitizer == nil {
+		return properties
+	}
+
+	return a.sanitizer.Sanitize(properties)
+}
+
+func (a *Analytics) sanitizeID(id string) string {
+	if a.sanitizer == nil {
+		return id
+	}
+
+	return a.sanitizer.SanitizeID(id)
+}
@@ -0,0 +1,157 @@
+package analytics
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/facily-tech/go-core/log"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeMasker struct{}
+
+func (fakeMasker) Email(eml string) string { return "email:" + eml[:2] }
+
+func (fakeMasker) Phone(pho string) string { return "phone:" + pho[len(pho)-2:] }
+
+func hmacHex(salt, value string) string {
+	mac := hmac.New(sha256.New, []byte(salt))
+	_, _ = mac.Write([]byte(value))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestSanitizePolicy_Sanitize(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     SanitizePolicy
+		properties map[string]interface{}
+		want       map[string]interface{}
+	}{
+		{
+			name:       "nil properties",
+			policy:     DefaultSanitizePolicy(fakeMasker{}, "salt"),
+			properties: nil,
+			want:       nil,
+		},
+		{
+			name:   "default policy",
+			policy: DefaultSanitizePolicy(fakeMasker{}, "salt"),
+			properties: map[string]interface{}{
+				"contact":  "user@facily.com.br",
+				"phone":    "+55 (11) 91234-5678",
+				"CPF":      "123.456.789-00",
+				"password": "123456",
+				"Token":    "abc",
+				"year":     "2021",
+				"value":    10,
+			},
+			want: map[string]interface{}{
+				"contact": "email:us",
+				"phone":   "phone:78",
+				"CPF":     hmacHex("salt", "123.456.789-00"),
+				"year":    "2021",
+				"value":   10,
+			},
+		},
+		{
+			name:   "nested values",
+			policy: DefaultSanitizePolicy(fakeMasker{}, "salt"),
+			properties: map[string]interface{}{
+				"customer": map[string]interface{}{"email": "user@facily.com.br", "senha": "123"},
+				"contacts": []string{"user@facily.com.br", "name"},
+			},
+			want: map[string]interface{}{
+				"customer": map[string]interface{}{"email": "email:us"},
+				"contacts": []interface{}{"email:us", "name"},
+			},
+		},
+		{
+			name: "mask without masker",
+			policy: SanitizePolicy{
+				Keys:   map[string]SanitizeAction{"document": SanitizeMask},
+				Emails: SanitizeMask,
+			},
+			properties: map[string]interface{}{"document": 123, "email": "user@facily.com.br"},
+			want:       map[string]interface{}{"document": maskedValue, "email": maskedValue},
+		},
+		{
+			name: "keep",
+			policy: SanitizePolicy{
+				Keys: map[string]SanitizeAction{"email": SanitizeKeep},
+			},
+			properties: map[string]interface{}{"email": "user@facily.com.br"},
+			want:       map[string]interface{}{"email": "user@facily.com.br"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.policy.Sanitize(tt.properties))
+		})
+	}
+}
+
+func TestAnalytics_WithSanitizer(t *testing.T) {
+	var got Event
+	//nolint:exhaustruct // accept default values at structs
+	a := &Analytics{
+		Sink: sinkFunc(func(ctx context.Context, event Event) error {
+			got = event
+
+			return nil
+		}),
+		Logger: log.NewMockLogger(gomock.NewController(t)),
+	}
+	a.WithSanitizer(DefaultSanitizePolicy(fakeMasker{}, "salt"))
+
+	properties := map[string]interface{}{"email": "user@facily.com.br", "password": "123"}
+	assert.NoError(t, a.TrackSync("eventName", properties))
+
+	assert.Equal(t, map[string]interface{}{"email": "email:us"}, got.Properties)
+	assert.Equal(t, "user@facily.com.br", properties["email"], "properties must not be changed")
+
+	assert.NoError(t, a.TrackSync("eventName", map[string]interface{}{"distinctId": "user@facily.com.br"}))
+	assert.Equal(t, hmacHex("salt", "user@facily.com.br"), got.DistinctID)
+}
+
+func TestSanitizePolicy_SanitizeID(t *testing.T) {
+	p := DefaultSanitizePolicy(fakeMasker{}, "salt")
+
+	tests := []struct {
+		name string
+		id   string
+		want string
+	}{
+		{name: "email", id: "user@facily.com.br", want: hmacHex("salt", "user@facily.com.br")},
+		{name: "phone", id: "+55 11 91234-5678", want: hmacHex("salt", "+55 11 91234-5678")},
+		{name: "customer id", id: "123", want: "123"},
+		{name: "uuid", id: "3f52960a-5b3c-4a8e-9a5e-0e5b0b6e7c1d", want: "3f52960a-5b3c-4a8e-9a5e-0e5b0b6e7c1d"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, p.SanitizeID(tt.id))
+		})
+	}
+
+	//nolint:exhaustruct // accept default values at structs
+	assert.Equal(t, "user@facily.com.br", SanitizePolicy{}.SanitizeID("user@facily.com.br"))
+}
+
+func TestAnalytics_WithSanitizer_profile(t *testing.T) {
+	sink := newProfileRecorder()
+	//nolint:exhaustruct // accept default values at structs
+	a := &Analytics{Sink: sink, Logger: log.NewMockLogger(gomock.NewController(t))}
+	a.WithWorkerPool(1)
+	a.WithSanitizer(DefaultSanitizePolicy(fakeMasker{}, "salt"))
+
+	a.SetProfile(context.Background(), "user@facily.com.br", nil)
+	a.Alias(context.Background(), "123", "user@facily.com.br")
+	a.Close()
+
+	assert.Equal(t, hmacHex("salt", "user@facily.com.br"), (<-sink.updates).DistinctID)
+	assert.Equal(t, [2]string{"123", hmacHex("salt", "user@facily.com.br")}, <-sink.aliases)
+}
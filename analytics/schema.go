@@ -0,0 +1,529 @@
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/facily-tech/go-core/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// PropertySchemaErrors is filled with validation problems when
+	// ValidationFlag is used.
+	PropertySchemaErrors = "schemaErrors"
+
+	schemaTag            = "analytics"
+	schemaEnumTag        = "enum"
+	schemaDescriptionTag = "description"
+	schemaRequired       = "required"
+	schemaOmitEmpty      = "omitempty"
+	jsonSchemaDraft      = "https://json-schema.org/draft/2020-12/schema"
+)
+
+var (
+	// ErrInvalidEvent error when event do not match its registered schema.
+	ErrInvalidEvent = errors.New("event do not match schema")
+	// ErrInvalidSchema error when a TypedEvent cannot be converted to schema.
+	ErrInvalidSchema = errors.New("invalid event schema")
+
+	timeType = reflect.TypeOf(time.Time{})
+
+	// typedSchemas caches schemas of TypedEvent types sent by TrackEvent.
+	typedSchemas sync.Map
+)
+
+// PropertyType is the json schema type of a property.
+type PropertyType string
+
+// Supported property types.
+const (
+	TypeString  PropertyType = "string"
+	TypeInteger PropertyType = "integer"
+	TypeNumber  PropertyType = "number"
+	TypeBoolean PropertyType = "boolean"
+	TypeArray   PropertyType = "array"
+	TypeObject  PropertyType = "object"
+)
+
+// ValidationMode defines what happens with events which do not match schema.
+type ValidationMode int
+
+const (
+	// ValidationReject do not send invalid events, TrackSync returns ErrInvalidEvent.
+	ValidationReject ValidationMode = iota
+	// ValidationFlag send invalid events with PropertySchemaErrors listing problems.
+	ValidationFlag
+)
+
+// TypedEvent is an event declared as a go struct, exported fields are the
+// event properties and can be tagged with:
+//
+//	analytics:"name,required"   property name (default field name) and requirement
+//	analytics:"name,omitempty"  zero values are not sent
+//	enum:"a,b,c"                allowed values
+//	description:"..."           documentation exported at json schema
+//
+// Fields tagged with analytics:"-" are ignored.
+type TypedEvent interface {
+	EventName() string
+}
+
+// PropertySchema describe a single event property.
+type PropertySchema struct {
+	Type        PropertyType
+	Format      string
+	Enum        []string
+	Description string
+}
+
+// EventSchema describe an event and its properties.
+type EventSchema struct {
+	Name       string
+	Properties map[string]PropertySchema
+	Required   []string
+
+	fields []schemaField
+}
+
+type schemaField struct {
+	index     int
+	property  string
+	omitEmpty bool
+}
+
+// Registry holds event schemas used to validate tracked events.
+type Registry struct {
+	mu      sync.RWMutex
+	schemas map[string]*EventSchema
+	// Strict makes events without schema invalid, except reserved events
+	// starting with "$" like "$identify".
+	Strict bool
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		schemas: make(map[string]*EventSchema),
+	}
+}
+
+// Register events schemas derived from their struct definition.
+func (r *Registry) Register(events ...TypedEvent) error {
+	for _, e := range events {
+		schema, err := NewEventSchema(e)
+		if err != nil {
+			return err
+		}
+
+		r.mu.Lock()
+		r.schemas[schema.Name] = schema
+		r.mu.Unlock()
+	}
+
+	return nil
+}
+
+// Schema returns the schema registered for eventName.
+func (r *Registry) Schema(eventName string) (*EventSchema, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, ok := r.schemas[eventName]
+
+	return s, ok
+}
+
+// Validate properties against the schema of eventName. Returned error wraps
+// ErrInvalidEvent and list every problem found.
+func (r *Registry) Validate(eventName string, properties map[string]interface{}) error {
+	if problems := r.problems(eventName, properties); len(problems) > 0 {
+		return invalidEventError(eventName, problems)
+	}
+
+	return nil
+}
+
+func invalidEventError(eventName string, problems []string) error {
+	return errors.Wrapf(ErrInvalidEvent, "event '%s': %s", eventName, strings.Join(problems, "; "))
+}
+
+func (r *Registry) problems(eventName string, properties map[string]interface{}) []string {
+	schema, ok := r.Schema(eventName)
+	if !ok {
+		if r.Strict && !strings.HasPrefix(eventName, "$") {
+			return []string{"event is not registered"}
+		}
+
+		return nil
+	}
+
+	return schema.validate(properties)
+}
+
+// JSONSchema export every registered event as a json schema document, each
+// event is a definition at "$defs".
+func (r *Registry) JSONSchema() ([]byte, error) {
+	r.mu.RLock()
+	defs := make(map[string]interface{}, len(r.schemas))
+	for name, s := range r.schemas {
+		defs[name] = s.JSONSchema()
+	}
+	r.mu.RUnlock()
+
+	b, err := json.MarshalIndent(map[string]interface{}{
+		"$schema": jsonSchemaDraft,
+		"title":   "analytics events",
+		"$defs":   defs,
+	}, "", "  ")
+
+	return b, errors.Wrap(err, "cannot marshal json schema")
+}
+
+// NewEventSchema creates an EventSchema from e struct definition.
+func NewEventSchema(e TypedEvent) (*EventSchema, error) {
+	t := reflect.TypeOf(e)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, errors.Wrapf(ErrInvalidSchema, "%T is not a struct", e)
+	}
+
+	schema := &EventSchema{
+		Name:       e.EventName(),
+		Properties: make(map[string]PropertySchema),
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get(schemaTag)
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+
+		opts := strings.Split(tag, ",")
+		name := opts[0]
+		if name == "" {
+			name = f.Name
+		}
+
+		typ, format, err := propertyType(f.Type)
+		if err != nil {
+			return nil, errors.Wrapf(err, "field %s", f.Name)
+		}
+
+		prop := PropertySchema{
+			Type:        typ,
+			Format:      format,
+			Description: f.Tag.Get(schemaDescriptionTag),
+		}
+		if enum := f.Tag.Get(schemaEnumTag); enum != "" {
+			prop.Enum = strings.Split(enum, ",")
+		}
+
+		field := schemaField{index: i, property: name, omitEmpty: false}
+		for _, o := range opts[1:] {
+			switch o {
+			case schemaRequired:
+				schema.Required = append(schema.Required, name)
+			case schemaOmitEmpty:
+				field.omitEmpty = true
+			}
+		}
+
+		schema.Properties[name] = prop
+		schema.fields = append(schema.fields, field)
+	}
+
+	return schema, nil
+}
+
+func propertyType(t reflect.Type) (PropertyType, string, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return TypeString, "date-time", nil
+	}
+
+	//nolint:exhaustive // unsupported kinds are handled by default.
+	switch t.Kind() {
+	case reflect.String:
+		return TypeString, "", nil
+	case reflect.Bool:
+		return TypeBoolean, "", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return TypeInteger, "", nil
+	case reflect.Float32, reflect.Float64:
+		return TypeNumber, "", nil
+	case reflect.Slice, reflect.Array:
+		return TypeArray, "", nil
+	case reflect.Map, reflect.Struct, reflect.Interface:
+		return TypeObject, "", nil
+	default:
+		return "", "", errors.Wrapf(ErrInvalidSchema, "unsupported type %s", t)
+	}
+}
+
+// properties converts e into event properties following schema fields, e
+// must be the type used to create s.
+func (s *EventSchema) properties(e TypedEvent) map[string]interface{} {
+	rv := reflect.ValueOf(e)
+	for rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+
+	props := make(map[string]interface{}, len(s.fields))
+	for _, f := range s.fields {
+		v := rv.Field(f.index)
+		if (v.Kind() == reflect.Ptr && v.IsNil()) || (f.omitEmpty && v.IsZero()) {
+			continue
+		}
+		props[f.property] = v.Interface()
+	}
+
+	return props
+}
+
+// validate returns every problem found at properties.
+func (s *EventSchema) validate(properties map[string]interface{}) []string {
+	var problems []string
+
+	for _, name := range s.Required {
+		if v, ok := properties[name]; !ok || v == nil {
+			problems = append(problems, fmt.Sprintf("missing required property '%s'", name))
+		}
+	}
+
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		v, ok := properties[name]
+		if !ok || v == nil {
+			continue
+		}
+
+		prop := s.Properties[name]
+		if !prop.accept(v) {
+			problems = append(problems, fmt.Sprintf("property '%s' must be %s, got %T", name, prop.Type, v))
+
+			continue
+		}
+
+		if value, ok := indirect(v); ok && len(prop.Enum) > 0 && !prop.inEnum(value) {
+			problems = append(problems, fmt.Sprintf("property '%s' must be one of [%s], got '%v'",
+				name, strings.Join(prop.Enum, ", "), value))
+		}
+	}
+
+	return problems
+}
+
+func (p PropertySchema) accept(v interface{}) bool {
+	if p.Type == TypeString && p.Format == "date-time" {
+		if _, ok := v.(time.Time); ok {
+			return true
+		}
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return true
+		}
+		rv = rv.Elem()
+	}
+
+	typ, _, err := propertyType(rv.Type())
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case typ == p.Type:
+		return true
+	case p.Type == TypeNumber && typ == TypeInteger:
+		return true
+	case p.Type == TypeInteger && typ == TypeNumber:
+		// numbers decoded from json are float64.
+		return rv.Float() == float64(int64(rv.Float()))
+	default:
+		return false
+	}
+}
+
+// indirect dereferences v pointers, false if one of them is nil.
+func indirect(v interface{}) (interface{}, bool) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr {
+		return v, true
+	}
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, false
+		}
+		rv = rv.Elem()
+	}
+
+	return rv.Interface(), true
+}
+
+func (p PropertySchema) inEnum(v interface{}) bool {
+	s := fmt.Sprint(v)
+	for _, e := range p.Enum {
+		if e == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// jsonEnum returns enum values using property type, so numeric enums are not
+// exported as strings.
+func (p PropertySchema) jsonEnum() []interface{} {
+	enum := make([]interface{}, len(p.Enum))
+	for i, e := range p.Enum {
+		enum[i] = e
+
+		if p.Type == TypeInteger || p.Type == TypeNumber {
+			n := json.Number(e)
+			if _, err := n.Float64(); err == nil {
+				enum[i] = n
+			}
+		}
+	}
+
+	return enum
+}
+
+// JSONSchema returns s as a json schema object.
+func (s *EventSchema) JSONSchema() map[string]interface{} {
+	props := make(map[string]interface{}, len(s.Properties))
+	for name, p := range s.Properties {
+		prop := map[string]interface{}{"type": p.Type}
+		if p.Format != "" {
+			prop["format"] = p.Format
+		}
+		if len(p.Enum) > 0 {
+			prop["enum"] = p.jsonEnum()
+		}
+		if p.Description != "" {
+			prop["description"] = p.Description
+		}
+		props[name] = prop
+	}
+
+	schema := map[string]interface{}{
+		"title":      s.Name,
+		"type":       TypeObject,
+		"properties": props,
+	}
+	if len(s.Required) > 0 {
+		schema["required"] = s.Required
+	}
+
+	return schema
+}
+
+// WithRegistry validate tracked events against registry schemas, mode defines
+// what happens with invalid events.
+
+// WithRegistry is a wrapper around DefaultClient.WithRegistry.
+func WithRegistry(registry *Registry, mode ValidationMode) {
+	Default().WithRegistry(registry, mode)
+}
+
+// WithRegistry validate tracked events against registry schemas, mode defines
+// what happens with invalid events.
+func (a *Analytics) WithRegistry(registry *Registry, mode ValidationMode) {
+	a.registry = registry
+	a.validation = mode
+}
+
+// TrackEvent queue a typed event to be sent, see TrackContext.
+
+// TrackEvent is a wrapper around DefaultClient.TrackEvent.
+func TrackEvent(ctx context.Context, event TypedEvent) {
+	Default().TrackEvent(ctx, event)
+}
+
+// TrackEvent queue a typed event to be sent, see TrackContext.
+func (a *Analytics) TrackEvent(ctx context.Context, event TypedEvent) {
+	props, err := typedProperties(event)
+	if err != nil {
+		a.Logger.Error(ctx, "Error creating event", log.Error(err))
+
+		return
+	}
+
+	a.TrackContext(ctx, event.EventName(), props)
+}
+
+// TrackEventSync send a typed event, see TrackSyncContext.
+
+// TrackEventSync is a wrapper around DefaultClient.TrackEventSync.
+func TrackEventSync(ctx context.Context, event TypedEvent) error {
+	return Default().TrackEventSync(ctx, event)
+}
+
+// TrackEventSync send a typed event, see TrackSyncContext.
+func (a *Analytics) TrackEventSync(ctx context.Context, event TypedEvent) error {
+	props, err := typedProperties(event)
+	if err != nil {
+		return err
+	}
+
+	return a.TrackSyncContext(ctx, event.EventName(), props)
+}
+
+func typedProperties(event TypedEvent) (map[string]interface{}, error) {
+	t := reflect.TypeOf(event)
+	if cached, ok := typedSchemas.Load(t); ok {
+		if schema, ok := cached.(*EventSchema); ok {
+			return schema.properties(event), nil
+		}
+	}
+
+	schema, err := NewEventSchema(event)
+	if err != nil {
+		return nil, err
+	}
+	typedSchemas.Store(t, schema)
+
+	return schema.properties(event), nil
+}
+
+// validate event properties using registry, invalid events returns error or
+// are flagged depending on validation mode.
+func (a *Analytics) validate(event *Event) error {
+	if a.registry == nil {
+		return nil
+	}
+
+	problems := a.registry.problems(event.Name, event.Properties)
+	if len(problems) == 0 {
+		return nil
+	}
+
+	if a.validation == ValidationFlag {
+		event.Properties[PropertySchemaErrors] = problems
+
+		return nil
+	}
+
+	return invalidEventError(event.Name, problems)
+}
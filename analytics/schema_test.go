@@ -0,0 +1,210 @@
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/facily-tech/go-core/log"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+type purchaseEvent struct {
+	OrderID  string    `analytics:"orderId,required" description:"order identifier"`
+	Value    float64   `analytics:"value,required"`
+	Items    int       `analytics:"items"`
+	Method   string    `analytics:"method,omitempty" enum:"pix,card"`
+	PaidAt   time.Time `analytics:"paidAt,omitempty"`
+	Coupon   *string   `analytics:"coupon"`
+	internal string
+	Ignored  string `analytics:"-"`
+}
+
+func (purchaseEvent) EventName() string { return "purchase" }
+
+type planEvent struct {
+	Plan *string `analytics:"plan" enum:"gold,silver"`
+}
+
+func (planEvent) EventName() string { return "plan" }
+
+type notStruct string
+
+func (notStruct) EventName() string { return "not struct" }
+
+func TestRegistry_Validate(t *testing.T) {
+	r := NewRegistry()
+	assert.NoError(t, r.Register(purchaseEvent{}))
+
+	tests := []struct {
+		name       string
+		event      string
+		properties map[string]interface{}
+		strict     bool
+		wantErr    bool
+	}{
+		{
+			name:       "valid",
+			event:      "purchase",
+			properties: map[string]interface{}{"orderId": "1", "value": 10, "items": 2.0, "method": "pix"},
+			wantErr:    false,
+		},
+		{
+			name:       "missing required",
+			event:      "purchase",
+			properties: map[string]interface{}{"value": 10.5},
+			wantErr:    true,
+		},
+		{
+			name:       "wrong type",
+			event:      "purchase",
+			properties: map[string]interface{}{"orderId": 1, "value": 10.5},
+			wantErr:    true,
+		},
+		{
+			name:       "not integer",
+			event:      "purchase",
+			properties: map[string]interface{}{"orderId": "1", "value": 10.5, "items": 1.5},
+			wantErr:    true,
+		},
+		{
+			name:       "not in enum",
+			event:      "purchase",
+			properties: map[string]interface{}{"orderId": "1", "value": 10.5, "method": "cash"},
+			wantErr:    true,
+		},
+		{
+			name:       "unregistered event",
+			event:      "page view",
+			properties: nil,
+			wantErr:    false,
+		},
+		{
+			name:       "unregistered event, strict",
+			event:      "page view",
+			properties: nil,
+			strict:     true,
+			wantErr:    true,
+		},
+		{
+			name:       "reserved event, strict",
+			event:      "$identify",
+			properties: map[string]interface{}{"$anon_id": "anonymous"},
+			strict:     true,
+			wantErr:    false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r.Strict = tt.strict
+
+			err := r.Validate(tt.event, tt.properties)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidEvent)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestRegistry_Validate_pointerEnum(t *testing.T) {
+	r := NewRegistry()
+	assert.NoError(t, r.Register(planEvent{}))
+
+	gold, bronze := "gold", "bronze"
+	assert.NoError(t, r.Validate("plan", map[string]interface{}{"plan": &gold}))
+	assert.NoError(t, r.Validate("plan", map[string]interface{}{"plan": (*string)(nil)}))
+
+	err := r.Validate("plan", map[string]interface{}{"plan": &bronze})
+	assert.ErrorIs(t, err, ErrInvalidEvent)
+	assert.Contains(t, err.Error(), "got 'bronze'")
+}
+
+func TestNewEventSchema(t *testing.T) {
+	s, err := NewEventSchema(&purchaseEvent{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "purchase", s.Name)
+	assert.Equal(t, []string{"orderId", "value"}, s.Required)
+	assert.Len(t, s.Properties, 6)
+	assert.Equal(t, PropertySchema{Type: TypeString, Format: "date-time"}, s.Properties["paidAt"])
+	assert.Equal(t, PropertySchema{Type: TypeString, Enum: []string{"pix", "card"}}, s.Properties["method"])
+
+	_, err = NewEventSchema(notStruct(""))
+	assert.ErrorIs(t, err, ErrInvalidSchema)
+}
+
+func TestRegistry_JSONSchema(t *testing.T) {
+	r := NewRegistry()
+	assert.NoError(t, r.Register(purchaseEvent{}))
+
+	b, err := r.JSONSchema()
+	assert.NoError(t, err)
+
+	var got map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b, &got))
+	assert.Equal(t, jsonSchemaDraft, got["$schema"])
+
+	purchase := got["$defs"].(map[string]interface{})["purchase"].(map[string]interface{})
+	assert.Equal(t, "object", purchase["type"])
+	assert.Equal(t, []interface{}{"orderId", "value"}, purchase["required"])
+	assert.Equal(t, map[string]interface{}{
+		"type":        "string",
+		"description": "order identifier",
+	}, purchase["properties"].(map[string]interface{})["orderId"])
+}
+
+func TestAnalytics_WithRegistry(t *testing.T) {
+	r := NewRegistry()
+	assert.NoError(t, r.Register(purchaseEvent{}))
+
+	t.Run("reject", func(t *testing.T) {
+		sent := 0
+		a := &Analytics{
+			Sink: sinkFunc(func(ctx context.Context, event Event) error {
+				sent++
+
+				return nil
+			}),
+			Logger: log.NewMockLogger(gomock.NewController(t)),
+		}
+		a.WithRegistry(r, ValidationReject)
+
+		err := a.TrackSync("purchase", map[string]interface{}{"value": 10})
+		assert.ErrorIs(t, err, ErrInvalidEvent)
+		assert.Equal(t, 0, sent)
+
+		assert.NoError(t, a.TrackEventSync(context.Background(), purchaseEvent{OrderID: "1", Value: 10}))
+		assert.Equal(t, 1, sent)
+	})
+	t.Run("flag", func(t *testing.T) {
+		var got Event
+		a := &Analytics{
+			Sink: sinkFunc(func(ctx context.Context, event Event) error {
+				got = event
+
+				return nil
+			}),
+			Logger: log.NewMockLogger(gomock.NewController(t)),
+		}
+		a.WithRegistry(r, ValidationFlag)
+
+		assert.NoError(t, a.TrackSync("purchase", map[string]interface{}{"value": 10}))
+		assert.Equal(t, []string{"missing required property 'orderId'"}, got.Properties[PropertySchemaErrors])
+	})
+	t.Run("properties filled by enrichers", func(t *testing.T) {
+		a := &Analytics{
+			Sink:   sinkFunc(func(ctx context.Context, event Event) error { return nil }),
+			Logger: log.NewMockLogger(gomock.NewController(t)),
+		}
+		a.WithRegistry(r, ValidationReject)
+		a.WithEnrichers(ContextValueEnricher("orderId", func(context.Context) (interface{}, bool) {
+			return "1", true
+		}))
+
+		assert.NoError(t, a.TrackSyncContext(context.Background(), "purchase", map[string]interface{}{"value": 10}))
+	})
+}
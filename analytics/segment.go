@@ -0,0 +1,132 @@
+package analytics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	segmentDefaultURL = "https://api.segment.io"
+	segmentTrackPath  = "/v1/track"
+	segmentBatchPath  = "/v1/batch"
+	segmentTypeTrack  = "track"
+)
+
+var _ BatchSink = (*SegmentSink)(nil)
+
+// SegmentSink is a Sink delivering events to segment http tracking api, any
+// segment compatible api (ex: rudderstack) can be used.
+type SegmentSink struct {
+	Client *http.Client
+
+	writeKey string
+	url      string
+}
+
+type segmentTrack struct {
+	Type       string                 `json:"type,omitempty"`
+	MessageID  string                 `json:"messageId"`
+	UserID     string                 `json:"userId"`
+	Event      string                 `json:"event"`
+	Timestamp  *time.Time             `json:"timestamp,omitempty"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+type segmentBatch struct {
+	Batch []segmentTrack `json:"batch"`
+}
+
+// NewSegmentSink returns a Sink delivering events to segment. url can be empty
+// and will default to "https://api.segment.io".
+func NewSegmentSink(writeKey, url string) *SegmentSink {
+	if url == "" {
+		url = segmentDefaultURL
+	}
+
+	return &SegmentSink{
+		Client:   http.DefaultClient,
+		writeKey: writeKey,
+		url:      url,
+	}
+}
+
+// Send event using segment track api.
+func (s *SegmentSink) Send(ctx context.Context, event Event) error {
+	if s.writeKey == "" {
+		return errors.WithStack(ErrEmptyToken)
+	}
+
+	body, err := json.Marshal(newSegmentTrack(event, ""))
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal segment event")
+	}
+
+	return s.post(ctx, segmentTrackPath, body)
+}
+
+// SendBatch events using segment batch api.
+func (s *SegmentSink) SendBatch(ctx context.Context, events []Event) error {
+	if s.writeKey == "" {
+		return errors.WithStack(ErrEmptyToken)
+	}
+
+	batch := segmentBatch{Batch: make([]segmentTrack, len(events))}
+	for i, e := range events {
+		batch.Batch[i] = newSegmentTrack(e, segmentTypeTrack)
+	}
+
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal segment events")
+	}
+
+	return s.post(ctx, segmentBatchPath, body)
+}
+
+func newSegmentTrack(event Event, eventType string) segmentTrack {
+	var timestamp *time.Time
+	if !event.Timestamp.IsZero() {
+		timestamp = &event.Timestamp
+	}
+
+	return segmentTrack{
+		Type:       eventType,
+		MessageID:  event.insertID(),
+		UserID:     event.DistinctID,
+		Event:      event.Name,
+		Timestamp:  timestamp,
+		Properties: event.Properties,
+	}
+}
+
+func (s *SegmentSink) post(ctx context.Context, path string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url+path, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "cannot create segment request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(s.writeKey, "")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "cannot send event to segment")
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "cannot read segment response")
+	}
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return errors.WithStack(&StatusError{StatusCode: resp.StatusCode, Body: string(respBody)})
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSegmentSink_Send(t *testing.T) {
+	tests := []struct {
+		name       string
+		writeKey   string
+		statusCode int
+		wantErr    bool
+	}{
+		{
+			name:       "success",
+			writeKey:   "key",
+			statusCode: http.StatusOK,
+			wantErr:    false,
+		},
+		{
+			name:       "empty write key",
+			writeKey:   "",
+			statusCode: http.StatusOK,
+			wantErr:    true,
+		},
+		{
+			name:       "segment fail",
+			writeKey:   "key",
+			statusCode: http.StatusBadRequest,
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, segmentTrackPath, r.URL.Path)
+
+				user, _, ok := r.BasicAuth()
+				assert.True(t, ok)
+				assert.Equal(t, tt.writeKey, user)
+
+				var got segmentTrack
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+				assert.NotEmpty(t, got.MessageID)
+				assert.Equal(t, "123", got.UserID)
+				assert.Equal(t, "eventName", got.Event)
+				assert.Equal(t, map[string]interface{}{"propertie": "value"}, got.Properties)
+
+				w.WriteHeader(tt.statusCode)
+			}))
+			defer ts.Close()
+
+			err := NewSegmentSink(tt.writeKey, ts.URL).Send(context.Background(), Event{
+				Name:       "eventName",
+				DistinctID: "123",
+				Timestamp:  time.Time{},
+				Properties: map[string]interface{}{"propertie": "value"},
+			})
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestSegmentSink_SendBatch(t *testing.T) {
+	var got segmentBatch
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, segmentBatchPath, r.URL.Path)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+	}))
+	defer ts.Close()
+
+	err := NewSegmentSink("key", ts.URL).SendBatch(context.Background(), []Event{
+		{Name: "a", DistinctID: "1", Timestamp: time.Now(), Properties: nil},
+		{Name: "b", DistinctID: "2", Timestamp: time.Now(), Properties: nil, InsertID: "b-1"},
+	})
+	assert.NoError(t, err)
+
+	assert.Len(t, got.Batch, 2)
+	assert.Equal(t, segmentTypeTrack, got.Batch[0].Type)
+	assert.Equal(t, "a", got.Batch[0].Event)
+	assert.Equal(t, "2", got.Batch[1].UserID)
+	assert.NotEmpty(t, got.Batch[0].MessageID)
+	assert.Equal(t, "b-1", got.Batch[1].MessageID)
+}
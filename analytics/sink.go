@@ -0,0 +1,84 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/multierr"
+)
+
+// Event is what Analytics hand over to a Sink.
+type Event struct {
+	// Name of the event, ex: "purchase", "page view".
+	Name string `json:"name"`
+	// DistinctID identify who generated the event.
+	DistinctID string `json:"distinctId"`
+	// Timestamp of the event, zero value means the backend should use current time.
+	Timestamp time.Time `json:"timestamp"`
+	// Properties of the event.
+	Properties map[string]interface{} `json:"properties,omitempty"`
+	// InsertID is unique per event and kept by retries and spool replays, so
+	// backends drop duplicated deliveries. Empty means a new one per delivery.
+	InsertID string `json:"insertId,omitempty"`
+}
+
+// insertID returns event InsertID or a random one if it's empty.
+func (e Event) insertID() string {
+	if e.InsertID == "" {
+		return uuid.NewString()
+	}
+
+	return e.InsertID
+}
+
+// Sink is a backend able to receive events like mixpanel or segment.
+type Sink interface {
+	// Send deliver event to the backend.
+	Send(ctx context.Context, event Event) error
+}
+
+var _ BatchSink = FanOutSink(nil)
+
+// FanOutSink deliver every event to all of its sinks, it's useful to dual-write
+// while migrating from one vendor to another.
+type FanOutSink []Sink
+
+// NewFanOutSink returns a Sink which deliver events to all sinks.
+func NewFanOutSink(sinks ...Sink) FanOutSink {
+	return FanOutSink(sinks)
+}
+
+// Send deliver event to every sink, a failing sink do not prevent the others
+// to receive event. Errors are combined.
+func (f FanOutSink) Send(ctx context.Context, event Event) error {
+	var err error
+	for _, s := range f {
+		err = multierr.Append(err, s.Send(ctx, event))
+	}
+
+	return err
+}
+
+// SendBatch deliver events to every sink, a failing sink do not prevent the
+// others to receive events. Errors are combined.
+func (f FanOutSink) SendBatch(ctx context.Context, events []Event) error {
+	var err error
+	for _, s := range f {
+		err = multierr.Append(err, SendBatch(ctx, s, events))
+	}
+
+	return err
+}
+
+// StatusError is returned by http based sinks when backend respond with an
+// unexpected status code.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d: %s", e.StatusCode, e.Body)
+}
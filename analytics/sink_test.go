@@ -0,0 +1,52 @@
+package analytics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type sinkFunc func(ctx context.Context, event Event) error
+
+func (f sinkFunc) Send(ctx context.Context, event Event) error {
+	return f(ctx, event)
+}
+
+func TestFanOutSink_Send(t *testing.T) {
+	t.Run("every sink receive event", func(t *testing.T) {
+		received := 0
+		s := NewFanOutSink(
+			sinkFunc(func(ctx context.Context, event Event) error {
+				received++
+
+				return nil
+			}),
+			sinkFunc(func(ctx context.Context, event Event) error {
+				received++
+
+				return nil
+			}),
+		)
+
+		assert.NoError(t, s.Send(context.Background(), Event{Name: "eventName"}))
+		assert.Equal(t, 2, received)
+	})
+	t.Run("failing sink do not prevent delivery", func(t *testing.T) {
+		received := 0
+		s := NewFanOutSink(
+			sinkFunc(func(ctx context.Context, event Event) error {
+				return errors.New("random error")
+			}),
+			sinkFunc(func(ctx context.Context, event Event) error {
+				received++
+
+				return nil
+			}),
+		)
+
+		assert.Error(t, s.Send(context.Background(), Event{Name: "eventName"}))
+		assert.Equal(t, 1, received)
+	})
+}
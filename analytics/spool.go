@@ -0,0 +1,542 @@
+package analytics
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/facily-tech/go-core/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultSpoolMaxBytes      = 100 << 20
+	defaultSpoolSegmentBytes  = 1 << 20
+	defaultSpoolFlushInterval = 5 * time.Second
+	defaultSpoolMinBackoff    = time.Second
+	defaultSpoolMaxBackoff    = time.Minute
+	defaultSpoolMaxAttempts   = 10
+
+	spoolSegmentExt  = ".seg"
+	spoolMagic       = "ASPL"
+	spoolVersion     = byte(1)
+	spoolHeaderSize  = len(spoolMagic) + 1
+	spoolRecordMeta  = 8
+	spoolFileMode    = 0o640
+	spoolDirFileMode = 0o750
+)
+
+// ErrCorruptedSegment error when a spool segment cannot be read.
+var ErrCorruptedSegment = errors.New("corrupted spool segment")
+
+// SpoolConfig configure the on-disk spool used to persist events until they are
+// delivered.
+type SpoolConfig struct {
+	// Dir where segments are stored, it's created if missing.
+	Dir string
+	// MaxBytes is the disk usage cap, oldest segments are evicted when it's
+	// exceeded, default 100MiB.
+	MaxBytes int64
+	// SegmentBytes is the size which a segment is sealed and delivered, default 1MiB.
+	SegmentBytes int64
+	// FlushInterval is the maximum time an event waits on the active segment
+	// before it's sealed and delivered, default 5s.
+	FlushInterval time.Duration
+	// MinBackoff is the wait after the first failed delivery, doubled after
+	// each consecutive failure, default 1s.
+	MinBackoff time.Duration
+	// MaxBackoff is the maximum wait between deliveries, default 1m.
+	MaxBackoff time.Duration
+	// MaxAttempts is how many times the oldest segment is delivered before its
+	// events are sent one by one, so a single undeliverable event do not block
+	// the others. Events still failing go to dead letter. Default 10, negative
+	// retries forever, which also keeps events during long sink outages.
+	MaxAttempts int
+}
+
+type spoolSegment struct {
+	seq  uint64
+	size int64
+}
+
+// spool is a write-ahead queue of events stored as segment files. Each segment
+// starts with a header (magic + version) followed by records of:
+//
+//	| length uint32 | crc32 uint32 | json encoded Event |
+//
+// Only sealed segments are delivered, oldest first, and removed after a
+// successful delivery. Segments found at Dir on start are replayed.
+//
+// Segments are synced to disk when sealed, so a process crash loses nothing,
+// but events at the active segment are lost if the machine crashes.
+type spool struct {
+	config  SpoolConfig
+	send    func(context.Context, []Event) error
+	discard func(error, ...Event)
+	logger  log.Logger
+
+	// failedSeq and failures count failed deliveries of the oldest segment,
+	// used only by run goroutine.
+	failedSeq uint64
+	failures  int
+
+	mu          sync.Mutex
+	active      *os.File
+	activeSeq   uint64
+	activeSize  int64
+	activeCount int
+	nextSeq     uint64
+	sealed      []spoolSegment
+	totalBytes  int64
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+func openSpool(
+	config SpoolConfig,
+	send func(context.Context, []Event) error,
+	discard func(error, ...Event),
+	logger log.Logger,
+) (*spool, error) {
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = defaultSpoolMaxBytes
+	}
+	if config.SegmentBytes <= 0 {
+		config.SegmentBytes = defaultSpoolSegmentBytes
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaultSpoolFlushInterval
+	}
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = defaultSpoolMinBackoff
+	}
+	if config.MaxBackoff < config.MinBackoff {
+		config.MaxBackoff = defaultSpoolMaxBackoff
+	}
+	if config.MaxAttempts == 0 {
+		config.MaxAttempts = defaultSpoolMaxAttempts
+	}
+
+	if err := os.MkdirAll(config.Dir, spoolDirFileMode); err != nil {
+		return nil, errors.Wrapf(err, "cannot create spool dir '%s'", config.Dir)
+	}
+
+	sealed, err := listSegments(config.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &spool{
+		config:  config,
+		send:    send,
+		discard: discard,
+		logger:  logger,
+		nextSeq: 1,
+		sealed:  sealed,
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	for _, seg := range sealed {
+		s.totalBytes += seg.size
+		s.nextSeq = seg.seq + 1
+	}
+
+	go s.run()
+	s.notify()
+
+	return s, nil
+}
+
+func listSegments(dir string) ([]spoolSegment, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot read spool dir '%s'", dir)
+	}
+
+	segments := make([]spoolSegment, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), spoolSegmentExt) {
+			continue
+		}
+
+		seq, err := strconv.ParseUint(strings.TrimSuffix(e.Name(), spoolSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot stat spool segment '%s'", e.Name())
+		}
+
+		segments = append(segments, spoolSegment{seq: seq, size: info.Size()})
+	}
+
+	sort.Slice(segments, func(i, j int) bool { return segments[i].seq < segments[j].seq })
+
+	return segments, nil
+}
+
+func (s *spool) path(seq uint64) string {
+	return filepath.Join(s.config.Dir, fmt.Sprintf("%020d%s", seq, spoolSegmentExt))
+}
+
+// write append event to the active segment.
+func (s *spool) write(event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal event to spool")
+	}
+
+	record := make([]byte, spoolRecordMeta+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	copy(record[spoolRecordMeta:], payload)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active == nil {
+		if err := s.openActiveLocked(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.active.Write(record)
+	if err != nil {
+		s.dropTornLocked(n)
+
+		return errors.Wrap(err, "cannot write event to spool")
+	}
+	s.activeSize += int64(n)
+	s.totalBytes += int64(n)
+	s.activeCount++
+
+	if s.activeSize >= s.config.SegmentBytes {
+		s.sealLocked()
+	}
+	s.evictLocked()
+
+	return nil
+}
+
+// dropTornLocked removes the n bytes of a short write, otherwise records
+// written after it would be unreadable. If it cannot be removed the segment is
+// sealed, so the torn record is its last one.
+func (s *spool) dropTornLocked(n int) {
+	if n == 0 {
+		return
+	}
+
+	if err := s.active.Truncate(s.activeSize); err != nil {
+		s.logger.Error(context.Background(), "cannot remove torn spool record", log.Error(err))
+		s.activeSize += int64(n)
+		s.totalBytes += int64(n)
+		s.sealLocked()
+	}
+}
+
+func (s *spool) openActiveLocked() error {
+	seq := s.nextSeq
+
+	f, err := os.OpenFile(s.path(seq), os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, spoolFileMode)
+	if err != nil {
+		return errors.Wrap(err, "cannot create spool segment")
+	}
+
+	n, err := f.Write(append([]byte(spoolMagic), spoolVersion))
+	if err != nil {
+		_ = f.Close()
+
+		return errors.Wrap(err, "cannot write spool segment header")
+	}
+
+	s.nextSeq++
+	s.active = f
+	s.activeSeq = seq
+	s.activeSize = int64(n)
+	s.activeCount = 0
+	s.totalBytes += int64(n)
+
+	return nil
+}
+
+// seal the active segment if it has events, making it ready to be delivered.
+func (s *spool) seal() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.activeCount > 0 {
+		s.sealLocked()
+	}
+}
+
+func (s *spool) sealLocked() {
+	if s.active == nil {
+		return
+	}
+
+	if err := s.active.Sync(); err != nil {
+		s.logger.Error(context.Background(), "cannot sync spool segment", log.Error(err))
+	}
+	if err := s.active.Close(); err != nil {
+		s.logger.Error(context.Background(), "cannot close spool segment", log.Error(err))
+	}
+	s.sealed = append(s.sealed, spoolSegment{seq: s.activeSeq, size: s.activeSize})
+	s.active = nil
+	s.activeSize = 0
+	s.activeCount = 0
+
+	s.notify()
+}
+
+// evictLocked remove oldest sealed segments while disk usage is over the cap.
+func (s *spool) evictLocked() {
+	for s.totalBytes > s.config.MaxBytes && len(s.sealed) > 0 {
+		oldest := s.sealed[0]
+		s.sealed = s.sealed[1:]
+		s.totalBytes -= oldest.size
+
+		if err := os.Remove(s.path(oldest.seq)); err != nil && !os.IsNotExist(err) {
+			s.logger.Error(context.Background(), "cannot evict spool segment", log.Error(err))
+		}
+		s.logger.Warn(context.Background(), "spool is full, oldest segment evicted",
+			log.Any("segment", oldest.seq), log.Any("bytes", oldest.size))
+	}
+}
+
+func (s *spool) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *spool) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.config.FlushInterval)
+	defer ticker.Stop()
+
+	backoff := s.config.MinBackoff
+	var (
+		nextAttempt time.Time
+		retry       <-chan time.Time
+	)
+
+	for {
+		select {
+		case <-s.stop:
+			s.seal()
+			if err := s.deliver(); err != nil {
+				s.logger.Warn(context.Background(), "undelivered events kept at spool", log.Error(err))
+			}
+
+			return
+		case <-ticker.C:
+			s.seal()
+		case <-s.wake:
+		case <-retry:
+			retry = nil
+		}
+
+		if time.Now().Before(nextAttempt) {
+			continue
+		}
+
+		if err := s.deliver(); err != nil {
+			s.logger.Error(context.Background(), "cannot deliver spool events, retrying",
+				log.Any("backoff", backoff.String()), log.Error(err))
+
+			nextAttempt = time.Now().Add(backoff)
+			retry = time.After(backoff)
+			backoff *= 2
+			if backoff > s.config.MaxBackoff {
+				backoff = s.config.MaxBackoff
+			}
+
+			continue
+		}
+
+		backoff = s.config.MinBackoff
+	}
+}
+
+// deliver sealed segments oldest first, stopping at the first failure.
+func (s *spool) deliver() error {
+	for {
+		s.mu.Lock()
+		if len(s.sealed) == 0 {
+			s.mu.Unlock()
+
+			return nil
+		}
+		seg := s.sealed[0]
+		s.mu.Unlock()
+
+		events, err := readSegment(s.path(seg.seq))
+		switch {
+		case os.IsNotExist(errors.Cause(err)):
+			// evicted while we were reading.
+		case err != nil:
+			s.logger.Error(context.Background(), "spool segment partially read",
+				log.Any("segment", seg.seq), log.Any("events", len(events)), log.Error(err))
+
+			fallthrough
+		default:
+			if len(events) > 0 {
+				if err := s.send(context.Background(), events); err != nil && !s.exhausted(seg, err, events) {
+					return err
+				}
+			}
+		}
+
+		s.remove(seg)
+	}
+}
+
+// exhausted counts a failed delivery of seg and, once MaxAttempts is reached,
+// sends its events one by one, discarding those which still fail. It returns
+// true if seg can be removed.
+func (s *spool) exhausted(seg spoolSegment, err error, events []Event) bool {
+	if s.failedSeq != seg.seq {
+		s.failedSeq = seg.seq
+		s.failures = 0
+	}
+	s.failures++
+
+	if s.config.MaxAttempts < 0 || s.failures < s.config.MaxAttempts {
+		return false
+	}
+
+	s.logger.Error(context.Background(), "spool segment failed too many times, sending events one by one",
+		log.Any("segment", seg.seq), log.Any("attempts", s.failures), log.Error(err))
+
+	for _, e := range events {
+		if err := s.send(context.Background(), []Event{e}); err != nil {
+			s.logger.Error(context.Background(), "Error sending spool event to sink, discarding", log.Error(err))
+			s.discard(err, e)
+		}
+	}
+
+	return true
+}
+
+func (s *spool) remove(seg spoolSegment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.sealed {
+		if s.sealed[i].seq == seg.seq {
+			s.sealed = append(s.sealed[:i], s.sealed[i+1:]...)
+			s.totalBytes -= seg.size
+
+			break
+		}
+	}
+
+	if err := os.Remove(s.path(seg.seq)); err != nil && !os.IsNotExist(err) {
+		s.logger.Error(context.Background(), "cannot remove spool segment", log.Error(err))
+	}
+}
+
+// readSegment return events stored at path. A torn or corrupted record stops
+// the reading, events read before it are returned with ErrCorruptedSegment.
+func readSegment(path string) ([]Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+
+	header := make([]byte, spoolHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, errors.Wrap(ErrCorruptedSegment, "cannot read header")
+	}
+	if string(header[:len(spoolMagic)]) != spoolMagic || header[len(spoolMagic)] != spoolVersion {
+		return nil, errors.Wrap(ErrCorruptedSegment, "unknown header")
+	}
+
+	var events []Event
+	meta := make([]byte, spoolRecordMeta)
+	for {
+		if _, err := io.ReadFull(r, meta); err != nil {
+			if errors.Is(err, io.EOF) {
+				return events, nil
+			}
+
+			return events, errors.Wrap(ErrCorruptedSegment, "torn record meta")
+		}
+
+		payload := make([]byte, binary.BigEndian.Uint32(meta[0:4]))
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return events, errors.Wrap(ErrCorruptedSegment, "torn record")
+		}
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(meta[4:8]) {
+			return events, errors.Wrap(ErrCorruptedSegment, "checksum mismatch")
+		}
+
+		var e Event
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return events, errors.Wrap(ErrCorruptedSegment, err.Error())
+		}
+		events = append(events, e)
+	}
+}
+
+// close stop delivery loop after a last delivery attempt, undelivered events
+// remain on disk to be replayed on next start.
+func (s *spool) close() {
+	close(s.stop)
+	<-s.done
+}
+
+// WithSpool persist every event sent by Track into config.Dir before delivery,
+// events survive crashes and sink outages and are replayed on start. Close
+// seal and try to deliver pending events.
+
+// WithSpool is a wrapper around DefaultClient.WithSpool.
+func WithSpool(config SpoolConfig) error {
+	return Default().WithSpool(config)
+}
+
+// WithSpool persist every event sent by Track into config.Dir before delivery,
+// events survive crashes and sink outages and are replayed on start. Close
+// seal and try to deliver pending events. Events failing with non retryable
+// errors, or after config.MaxAttempts, are discarded and sent to dead letter.
+func (a *Analytics) WithSpool(config SpoolConfig) error {
+	a.initDefault()
+
+	return a.withSpool(config)
+}
+
+func (a *Analytics) withSpool(config SpoolConfig) error {
+	if a.spool != nil {
+		a.spool.close()
+		a.spool = nil
+	}
+
+	s, err := openSpool(config, a.deliverSpool, a.toDeadLetter, a.Logger)
+	if err != nil {
+		return err
+	}
+	a.spool = s
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package analytics
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/facily-tech/go-core/log"
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type spoolRecorder struct {
+	mu        sync.Mutex
+	events    []Event
+	discarded []Event
+	err       error
+	// poison fails every delivery containing an event with this name.
+	poison string
+}
+
+func (r *spoolRecorder) send(_ context.Context, events []Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+	for _, e := range events {
+		if r.poison != "" && e.Name == r.poison {
+			return errors.New("poison event")
+		}
+	}
+	r.events = append(r.events, events...)
+
+	return nil
+}
+
+func (r *spoolRecorder) toDeadLetter(_ error, events ...Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.discarded = append(r.discarded, events...)
+}
+
+func (r *spoolRecorder) names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, len(r.events))
+	for i := range r.events {
+		names[i] = r.events[i].Name
+	}
+
+	return names
+}
+
+func spoolLogger(t *testing.T) log.Logger {
+	t.Helper()
+
+	l := log.NewMockLogger(gomock.NewController(t))
+	l.EXPECT().Error(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	l.EXPECT().Error(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	l.EXPECT().Error(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	l.EXPECT().Warn(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	l.EXPECT().Warn(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+
+	return l
+}
+
+func TestSpool(t *testing.T) {
+	t.Run("deliver sealed segments", func(t *testing.T) {
+		r := &spoolRecorder{}
+		s, err := openSpool(SpoolConfig{Dir: t.TempDir(), FlushInterval: time.Millisecond}, r.send, r.toDeadLetter, spoolLogger(t))
+		assert.NoError(t, err)
+
+		assert.NoError(t, s.write(Event{Name: "a"}))
+		assert.NoError(t, s.write(Event{Name: "b"}))
+
+		assert.Eventually(t, func() bool {
+			return len(r.names()) == 2
+		}, time.Second, time.Millisecond)
+		s.close()
+
+		assert.Equal(t, []string{"a", "b"}, r.names())
+	})
+	t.Run("undelivered events are replayed on start", func(t *testing.T) {
+		dir := t.TempDir()
+		failing := &spoolRecorder{err: errors.New("mixpanel is down")}
+		s, err := openSpool(SpoolConfig{Dir: dir, FlushInterval: time.Hour}, failing.send, failing.toDeadLetter, spoolLogger(t))
+		assert.NoError(t, err)
+
+		assert.NoError(t, s.write(Event{Name: "a"}))
+		assert.NoError(t, s.write(Event{Name: "b"}))
+		s.close()
+
+		segments, err := listSegments(dir)
+		assert.NoError(t, err)
+		assert.Len(t, segments, 1)
+
+		r := &spoolRecorder{}
+		s, err = openSpool(SpoolConfig{Dir: dir, FlushInterval: time.Hour}, r.send, r.toDeadLetter, spoolLogger(t))
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			return len(r.names()) == 2
+		}, time.Second, time.Millisecond)
+		s.close()
+
+		segments, err = listSegments(dir)
+		assert.NoError(t, err)
+		assert.Empty(t, segments)
+	})
+	t.Run("poison event is discarded after max attempts", func(t *testing.T) {
+		r := &spoolRecorder{poison: "poison"}
+		s, err := openSpool(SpoolConfig{
+			Dir:           t.TempDir(),
+			FlushInterval: time.Millisecond,
+			MinBackoff:    time.Millisecond,
+			MaxBackoff:    time.Millisecond,
+			MaxAttempts:   3,
+		}, r.send, r.toDeadLetter, spoolLogger(t))
+		assert.NoError(t, err)
+
+		assert.NoError(t, s.write(Event{Name: "a"}))
+		assert.NoError(t, s.write(Event{Name: "poison"}))
+		assert.NoError(t, s.write(Event{Name: "b"}))
+
+		assert.Eventually(t, func() bool {
+			return len(r.names()) == 2
+		}, time.Second, time.Millisecond)
+		s.close()
+
+		assert.Equal(t, []string{"a", "b"}, r.names())
+		assert.Len(t, r.discarded, 1)
+		assert.Equal(t, "poison", r.discarded[0].Name)
+	})
+	t.Run("evict oldest segment when disk cap is reached", func(t *testing.T) {
+		dir := t.TempDir()
+		failing := &spoolRecorder{err: errors.New("mixpanel is down")}
+		s, err := openSpool(SpoolConfig{
+			Dir:           dir,
+			MaxBytes:      200,
+			SegmentBytes:  1,
+			FlushInterval: time.Hour,
+			MinBackoff:    time.Hour,
+		}, failing.send, failing.toDeadLetter, spoolLogger(t))
+		assert.NoError(t, err)
+
+		for _, name := range []string{"a", "b", "c", "d", "e"} {
+			assert.NoError(t, s.write(Event{Name: name}))
+		}
+		s.close()
+
+		segments, err := listSegments(dir)
+		assert.NoError(t, err)
+		assert.Less(t, len(segments), 5)
+
+		var names []string
+		for _, seg := range segments {
+			events, err := readSegment(s.path(seg.seq))
+			assert.NoError(t, err)
+			for _, e := range events {
+				names = append(names, e.Name)
+			}
+		}
+		assert.Equal(t, "e", names[len(names)-1])
+		assert.NotContains(t, names, "a")
+	})
+}
+
+func TestReadSegment(t *testing.T) {
+	dir := t.TempDir()
+	failing := &spoolRecorder{err: errors.New("mixpanel is down")}
+	s, err := openSpool(SpoolConfig{Dir: dir, FlushInterval: time.Hour}, failing.send, failing.toDeadLetter, spoolLogger(t))
+	assert.NoError(t, err)
+	assert.NoError(t, s.write(Event{Name: "a"}))
+	assert.NoError(t, s.write(Event{Name: "b"}))
+	s.close()
+
+	path := s.path(1)
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	// simulate a crash in the middle of the last write.
+	assert.NoError(t, os.Truncate(path, info.Size()-3))
+
+	events, err := readSegment(path)
+	assert.ErrorIs(t, err, ErrCorruptedSegment)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "a", events[0].Name)
+}
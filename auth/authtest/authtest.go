@@ -0,0 +1,249 @@
+/*
+Package authtest runs a local OIDC issuer minting signed tokens, so services
+can test auth middlewares end to end without network or mocks.
+*/
+package authtest
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/facily-tech/go-core/auth"
+	"github.com/facily-tech/go-core/log"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+const (
+	// DefaultSubject is the sub claim of tokens without WithSubject.
+	DefaultSubject = "authtest-user"
+	// DefaultExpiry is how long tokens are valid without WithExpiry.
+	DefaultExpiry = time.Hour
+
+	keyID   = "authtest"
+	keySize = 2048
+)
+
+// TokenOption changes the claims of a minted token.
+type TokenOption func(claims auth.Claims)
+
+// WithClaims sets arbitrary claims, replacing defaults with the same name.
+func WithClaims(c auth.Claims) TokenOption {
+	return func(claims auth.Claims) {
+		for k, v := range c {
+			claims[k] = v
+		}
+	}
+}
+
+// WithSubject sets sub claim.
+func WithSubject(sub string) TokenOption {
+	return WithClaims(auth.Claims{auth.ClaimSubject: sub})
+}
+
+// WithRoles sets keycloak realm roles, see auth.HasRole.
+func WithRoles(roles ...string) TokenOption {
+	return WithClaims(auth.Claims{"realm_access": map[string]interface{}{"roles": roles}})
+}
+
+// WithClientRoles sets keycloak roles of client, see auth.HasClientRole.
+// It may be used many times with different clients.
+func WithClientRoles(client string, roles ...string) TokenOption {
+	return func(claims auth.Claims) {
+		access, ok := claims["resource_access"].(map[string]interface{})
+		if !ok {
+			access = map[string]interface{}{}
+			claims["resource_access"] = access
+		}
+		access[client] = map[string]interface{}{"roles": roles}
+	}
+}
+
+// WithScopes sets scope claim, see auth.HasScope.
+func WithScopes(scopes ...string) TokenOption {
+	return WithClaims(auth.Claims{"scope": strings.Join(scopes, " ")})
+}
+
+// WithExpiry sets exp claim to d from now, negative d mints expired tokens.
+func WithExpiry(d time.Duration) TokenOption {
+	return WithClaims(auth.Claims{auth.ClaimExpiresAt: time.Now().Add(d).Unix()})
+}
+
+// Issuer is a local OIDC issuer serving discovery and JWKS endpoints.
+type Issuer struct {
+	t        testing.TB
+	server   *httptest.Server
+	clientID string
+	key      *rsa.PrivateKey
+}
+
+// NewIssuer starts an Issuer minting tokens for clientID, it is closed when
+// test ends.
+func NewIssuer(t testing.TB, clientID string) *Issuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, keySize)
+	if err != nil {
+		t.Fatalf("authtest: cannot generate key: %v", err)
+	}
+
+	i := &Issuer{
+		t:        t,
+		server:   nil,
+		clientID: clientID,
+		key:      key,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", i.discovery)
+	mux.HandleFunc("/jwks", i.jwks)
+	i.server = httptest.NewServer(mux)
+	t.Cleanup(i.server.Close)
+
+	return i
+}
+
+// URL is the issuer, iss claim of minted tokens.
+func (i *Issuer) URL() string {
+	return i.server.URL
+}
+
+// ClientID is the aud and azp claims of minted tokens.
+func (i *Issuer) ClientID() string {
+	return i.clientID
+}
+
+// OIDC returns an *auth.OIDC trusting the issuer, logging to test output.
+func (i *Issuer) OIDC() *auth.OIDC {
+	i.t.Helper()
+
+	o, err := auth.New(testLogger{i.t}, i.clientID, i.URL())
+	if err != nil {
+		i.t.Fatalf("authtest: cannot create oidc: %v", err)
+	}
+
+	return o
+}
+
+// Token mints a signed token, valid by default for DefaultExpiry with
+// DefaultSubject, changed by opts.
+func (i *Issuer) Token(opts ...TokenOption) string {
+	i.t.Helper()
+
+	now := time.Now()
+	claims := auth.Claims{
+		"iss":                     i.URL(),
+		"aud":                     i.clientID,
+		auth.ClaimAuthorizedParty: i.clientID,
+		auth.ClaimSubject:         DefaultSubject,
+		"iat":                     now.Unix(),
+		auth.ClaimExpiresAt:       now.Add(DefaultExpiry).Unix(),
+	}
+	for _, opt := range opts {
+		opt(claims)
+	}
+
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: i.key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", keyID),
+	)
+	if err != nil {
+		i.t.Fatalf("authtest: cannot create signer: %v", err)
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		i.t.Fatalf("authtest: cannot marshal claims: %v", err)
+	}
+
+	jws, err := signer.Sign(payload)
+	if err != nil {
+		i.t.Fatalf("authtest: cannot sign token: %v", err)
+	}
+
+	token, err := jws.CompactSerialize()
+	if err != nil {
+		i.t.Fatalf("authtest: cannot serialize token: %v", err)
+	}
+
+	return token
+}
+
+// Authorize sets r Authorization header with a token minted using opts.
+func (i *Issuer) Authorize(r *http.Request, opts ...TokenOption) *http.Request {
+	i.t.Helper()
+
+	r.Header.Set("Authorization", "Bearer "+i.Token(opts...))
+
+	return r
+}
+
+func (i *Issuer) discovery(w http.ResponseWriter, _ *http.Request) {
+	i.writeJSON(w, map[string]interface{}{
+		"issuer":                                i.URL(),
+		"authorization_endpoint":                i.URL() + "/auth",
+		"token_endpoint":                        i.URL() + "/token",
+		"jwks_uri":                              i.URL() + "/jwks",
+		"id_token_signing_alg_values_supported": []string{string(jose.RS256)},
+	})
+}
+
+func (i *Issuer) jwks(w http.ResponseWriter, _ *http.Request) {
+	i.writeJSON(w, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+		Key:       &i.key.PublicKey,
+		KeyID:     keyID,
+		Algorithm: string(jose.RS256),
+		Use:       "sig",
+	}}})
+}
+
+func (i *Issuer) writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		i.t.Errorf("authtest: cannot write response: %v", err)
+	}
+}
+
+// testLogger write auth logs using t.Logf, like zap Fatal stops the caller,
+// failing the test, and Panic panics.
+type testLogger struct {
+	t testing.TB
+}
+
+func (l testLogger) log(level, msg string, fields []log.Field) {
+	l.t.Helper()
+	l.t.Logf("auth %s: %s %v", level, msg, fields)
+}
+
+func (l testLogger) Error(_ context.Context, msg string, fields ...log.Field) {
+	l.log("error", msg, fields)
+}
+
+func (l testLogger) Debug(_ context.Context, msg string, fields ...log.Field) {
+	l.log("debug", msg, fields)
+}
+
+func (l testLogger) Fatal(_ context.Context, msg string, fields ...log.Field) {
+	l.t.Helper()
+	l.t.Fatalf("auth fatal: %s %v", msg, fields)
+}
+
+func (l testLogger) Info(_ context.Context, msg string, fields ...log.Field) {
+	l.log("info", msg, fields)
+}
+
+func (l testLogger) Panic(_ context.Context, msg string, fields ...log.Field) {
+	l.t.Helper()
+	l.log("panic", msg, fields)
+	panic(msg)
+}
+
+func (l testLogger) Warn(_ context.Context, msg string, fields ...log.Field) {
+	l.log("warn", msg, fields)
+}
@@ -0,0 +1,84 @@
+package authtest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/facily-tech/go-core/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIssuer(t *testing.T) {
+	issuer := NewIssuer(t, "sellers-backend")
+	o := issuer.OIDC()
+
+	tests := []struct {
+		name       string
+		middleware func(next http.Handler) http.Handler
+		opts       []TokenOption
+		want       int
+	}{
+		{name: "valid token", opts: nil, want: http.StatusOK},
+		{name: "expired token", opts: []TokenOption{WithExpiry(-time.Minute)}, want: http.StatusUnauthorized},
+		{
+			name: "wrong audience",
+			opts: []TokenOption{WithClaims(auth.Claims{"aud": "other"})},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name:       "realm role",
+			middleware: auth.HasRoleMiddleware("view"),
+			opts:       []TokenOption{WithRoles("view", "charge")},
+			want:       http.StatusOK,
+		},
+		{
+			name:       "missing realm role",
+			middleware: auth.HasRoleMiddleware("view"),
+			opts:       []TokenOption{WithRoles("charge")},
+			want:       http.StatusForbidden,
+		},
+		{
+			name:       "client role",
+			middleware: auth.HasClientRoleMiddleware("payments", "refund"),
+			opts:       []TokenOption{WithClientRoles("sellers-backend", "view"), WithClientRoles("payments", "refund")},
+			want:       http.StatusOK,
+		},
+		{
+			name:       "scope",
+			middleware: auth.HasScopeMiddleware("seller"),
+			opts:       []TokenOption{WithScopes("openid", "seller")},
+			want:       http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var next http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+			if tt.middleware != nil {
+				next = tt.middleware(next)
+			}
+			r := issuer.Authorize(httptest.NewRequest(http.MethodGet, "/", nil), tt.opts...)
+			w := httptest.NewRecorder()
+
+			o.Auth(next).ServeHTTP(w, r)
+
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+}
+
+func TestIssuer_Token_claims(t *testing.T) {
+	issuer := NewIssuer(t, "sellers-backend")
+
+	var got auth.Claims
+	r := issuer.Authorize(httptest.NewRequest(http.MethodGet, "/", nil), WithSubject("user-1"))
+	issuer.OIDC().Auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = auth.GetClaims(r.Context())
+	})).ServeHTTP(httptest.NewRecorder(), r)
+
+	assert.Equal(t, "user-1", got.Subject())
+	assert.Equal(t, issuer.URL(), got["iss"])
+	assert.Equal(t, issuer.ClientID(), got.AuthorizedParty())
+	assert.WithinDuration(t, time.Now().Add(DefaultExpiry), got.ExpiresAt(), time.Minute)
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Standard claim names.
+const (
+	ClaimSubject           = "sub"
+	ClaimEmail             = "email"
+	ClaimPreferredUsername = "preferred_username"
+	ClaimExpiresAt         = "exp"
+	ClaimIssuedAt          = "iat"
+	ClaimAuthorizedParty   = "azp"
+	ClaimTokenID           = "jti"
+	ClaimSessionID         = "sid"
+)
+
+// ErrNoClaims error when context has no claims, generally because OIDC.Auth
+// was not used.
+var ErrNoClaims = errors.New("no claims at context")
+
+// GetClaims return claims from ctx. ctx should be populated before calling
+// GetClaims with the token claims, generally using OIDC.Auth method.
+func GetClaims(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(contextKey).(Claims)
+
+	return claims, ok
+}
+
+// ClaimsAs decode claims from ctx into T, generally a struct using json tags.
+// ctx should be populated before calling ClaimsAs with the token claims,
+// generally using OIDC.Auth method.
+func ClaimsAs[T any](ctx context.Context) (T, error) {
+	var t T
+
+	claims, ok := GetClaims(ctx)
+	if !ok {
+		return t, errors.WithStack(ErrNoClaims)
+	}
+
+	return t, claims.Decode(&t)
+}
+
+// Decode claims into v, generally a pointer to a struct using json tags.
+func (c Claims) Decode(v interface{}) error {
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal claims")
+	}
+
+	return errors.Wrap(json.Unmarshal(raw, v), "cannot unmarshal claims")
+}
+
+// String returns claim as string, empty if absent or not a string.
+func (c Claims) String(claim string) string {
+	s, _ := c[claim].(string)
+
+	return s
+}
+
+// Subject returns sub claim.
+func (c Claims) Subject() string {
+	return c.String(ClaimSubject)
+}
+
+// Email returns email claim.
+func (c Claims) Email() string {
+	return c.String(ClaimEmail)
+}
+
+// PreferredUsername returns preferred_username claim.
+func (c Claims) PreferredUsername() string {
+	return c.String(ClaimPreferredUsername)
+}
+
+// AuthorizedParty returns azp claim, the client id the token was issued to.
+func (c Claims) AuthorizedParty() string {
+	return c.String(ClaimAuthorizedParty)
+}
+
+// ExpiresAt returns exp claim, zero time if absent.
+func (c Claims) ExpiresAt() time.Time {
+	return c.Time(ClaimExpiresAt)
+}
+
+// IssuedAt returns iat claim, zero time if absent.
+func (c Claims) IssuedAt() time.Time {
+	return c.Time(ClaimIssuedAt)
+}
+
+// Time returns a numeric date claim, zero time if absent or not a number.
+func (c Claims) Time(claim string) time.Time {
+	switch t := c[claim].(type) {
+	case float64:
+		return time.Unix(int64(t), 0)
+	case int64:
+		return time.Unix(t, 0)
+	case int:
+		return time.Unix(int64(t), 0)
+	case json.Number:
+		if n, err := t.Int64(); err == nil {
+			return time.Unix(n, 0)
+		}
+	}
+
+	return time.Time{}
+}
+
+// Subject returns sub claim from ctx, empty if absent.
+func Subject(ctx context.Context) string {
+	claims, _ := GetClaims(ctx)
+
+	return claims.Subject()
+}
+
+// Email returns email claim from ctx, empty if absent.
+func Email(ctx context.Context) string {
+	claims, _ := GetClaims(ctx)
+
+	return claims.Email()
+}
+
+// PreferredUsername returns preferred_username claim from ctx, empty if absent.
+func PreferredUsername(ctx context.Context) string {
+	claims, _ := GetClaims(ctx)
+
+	return claims.PreferredUsername()
+}
+
+// AuthorizedParty returns azp claim from ctx, empty if absent.
+func AuthorizedParty(ctx context.Context) string {
+	claims, _ := GetClaims(ctx)
+
+	return claims.AuthorizedParty()
+}
+
+// ExpiresAt returns exp claim from ctx, zero time if absent.
+func ExpiresAt(ctx context.Context) time.Time {
+	claims, _ := GetClaims(ctx)
+
+	return claims.ExpiresAt()
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type customClaims struct {
+	Subject     string `json:"sub"`
+	ClientID    string `json:"clientId"`
+	RealmAccess struct {
+		Roles []string `json:"roles"`
+	} `json:"realm_access"`
+}
+
+func TestClaimsAs(t *testing.T) {
+	t.Run("decode", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), contextKey, Claims{
+			"sub":          "123",
+			"clientId":     "sellers-backend",
+			"realm_access": map[string]interface{}{"roles": []interface{}{"view"}},
+		})
+
+		got, err := ClaimsAs[customClaims](ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "123", got.Subject)
+		assert.Equal(t, "sellers-backend", got.ClientID)
+		assert.Equal(t, []string{"view"}, got.RealmAccess.Roles)
+	})
+	t.Run("wrong type", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), contextKey, Claims{"sub": 123})
+
+		_, err := ClaimsAs[customClaims](ctx)
+		assert.Error(t, err)
+	})
+	t.Run("no claims", func(t *testing.T) {
+		_, err := ClaimsAs[customClaims](context.Background())
+		assert.ErrorIs(t, err, ErrNoClaims)
+	})
+}
+
+func TestStandardClaims(t *testing.T) {
+	ctx := context.WithValue(context.Background(), contextKey, Claims{
+		"sub":                "123",
+		"email":              "user@facily.com.br",
+		"preferred_username": "user",
+		"azp":                "sellers-backend",
+		"exp":                float64(1660851868),
+	})
+
+	assert.Equal(t, "123", Subject(ctx))
+	assert.Equal(t, "user@facily.com.br", Email(ctx))
+	assert.Equal(t, "user", PreferredUsername(ctx))
+	assert.Equal(t, "sellers-backend", AuthorizedParty(ctx))
+	assert.Equal(t, time.Unix(1660851868, 0), ExpiresAt(ctx))
+
+	empty := context.Background()
+	assert.Empty(t, Subject(empty))
+	assert.Empty(t, Email(empty))
+	assert.Empty(t, PreferredUsername(empty))
+	assert.Empty(t, AuthorizedParty(empty))
+	assert.True(t, ExpiresAt(empty).IsZero())
+}
@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Error codes defined by RFC 6750.
+const (
+	ErrorCodeInvalidRequest    = "invalid_request"
+	ErrorCodeInvalidToken      = "invalid_token"
+	ErrorCodeInsufficientScope = "insufficient_scope"
+)
+
+// AuthError is an authentication or authorization failure, Description is
+// safe to be sent to clients while Err, the cause, is only logged.
+type AuthError struct {
+	// Status is the http status code, 400, 401, 403 or 503 when revocation
+	// cannot be checked.
+	Status int
+	// Code is one of ErrorCode constants, empty when request has no token or
+	// on 503.
+	Code string
+	// Description is a human readable explanation sent to client.
+	Description string
+	// Scope required to access the resource, if known.
+	Scope string
+	// Err is the cause of the failure.
+	Err error
+}
+
+// Error implements error.
+func (e *AuthError) Error() string {
+	msg := fmt.Sprintf("auth: %d %s: %s", e.Status, e.Code, e.Description)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+
+	return msg
+}
+
+// Unwrap returns the cause of the failure.
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorHandler writes err response, use it to control the response format.
+type ErrorHandler func(w http.ResponseWriter, r *http.Request, err *AuthError)
+
+// DefaultErrorHandler is used by middlewares without an ErrorHandler, like
+// HasRoleMiddleware and Require. Change it at startup to control the response
+// format of every middleware.
+var DefaultErrorHandler ErrorHandler = WriteError
+
+// problem is a RFC 7807 response body.
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// WriteError writes err with a RFC 6750 WWW-Authenticate header and a RFC 7807
+// problem json body.
+func WriteError(w http.ResponseWriter, _ *http.Request, err *AuthError) {
+	if err.Status == http.StatusUnauthorized || err.Code != "" {
+		w.Header().Set("WWW-Authenticate", wwwAuthenticate(err))
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(err.Status)
+
+	_ = json.NewEncoder(w).Encode(problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(err.Status),
+		Status: err.Status,
+		Detail: err.Description,
+		Error:  err.Code,
+	})
+}
+
+func wwwAuthenticate(err *AuthError) string {
+	params := make([]string, 0, 3)
+	if err.Code != "" {
+		params = append(params, fmt.Sprintf("error=%q", err.Code))
+		if err.Description != "" {
+			params = append(params, fmt.Sprintf("error_description=%q", err.Description))
+		}
+	}
+	if err.Scope != "" {
+		params = append(params, fmt.Sprintf("scope=%q", err.Scope))
+	}
+
+	if len(params) == 0 {
+		return "Bearer"
+	}
+
+	return "Bearer " + strings.Join(params, ", ")
+}
+
+// errorHandler returns h, or DefaultErrorHandler if h is nil.
+func errorHandler(h ErrorHandler) ErrorHandler {
+	if h != nil {
+		return h
+	}
+
+	return DefaultErrorHandler
+}
+
+// MiddlewareOption configures authorization middlewares, like
+// HasRoleMiddleware and Require.
+type MiddlewareOption func(*middlewareConfig)
+
+type middlewareConfig struct {
+	errorHandler ErrorHandler
+}
+
+// OnError makes the middleware write failures using h instead of
+// DefaultErrorHandler.
+func OnError(h ErrorHandler) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.errorHandler = h
+	}
+}
+
+func newMiddlewareConfig(opts []MiddlewareOption) middlewareConfig {
+	c := middlewareConfig{errorHandler: nil}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	return c
+}
+
+// onError writes err using the handler given by OnError or, resolved at
+// request time, DefaultErrorHandler.
+func (c middlewareConfig) onError(w http.ResponseWriter, r *http.Request, err *AuthError) {
+	errorHandler(c.errorHandler)(w, r, err)
+}
+
+// unauthenticated is used when the request has no verified claims.
+func unauthenticated(err error) *AuthError {
+	return &AuthError{
+		Status:      http.StatusUnauthorized,
+		Code:        "",
+		Description: "authentication required",
+		Scope:       "",
+		Err:         err,
+	}
+}
+
+// forbidden is used when claims do not satisfy the resource requirements.
+func forbidden(description, scope string, err error) *AuthError {
+	return &AuthError{
+		Status:      http.StatusForbidden,
+		Code:        ErrorCodeInsufficientScope,
+		Description: description,
+		Scope:       scope,
+		Err:         err,
+	}
+}
+
+// authorizationError converts Authorize errors to AuthError.
+func authorizationError(err error) *AuthError {
+	var deny *DenyError
+	if errors.As(err, &deny) {
+		return forbidden("insufficient permissions", "", err)
+	}
+
+	return unauthenticated(err)
+}
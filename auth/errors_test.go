@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/facily-tech/go-core/log"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        *AuthError
+		wantHeader string
+	}{
+		{
+			name:       "missing token",
+			err:        unauthenticated(nil),
+			wantHeader: "Bearer",
+		},
+		{
+			name: "invalid token",
+			err: &AuthError{
+				Status:      http.StatusUnauthorized,
+				Code:        ErrorCodeInvalidToken,
+				Description: "token is invalid or expired",
+			},
+			wantHeader: `Bearer error="invalid_token", error_description="token is invalid or expired"`,
+		},
+		{
+			name:       "insufficient scope",
+			err:        forbidden("missing scope", "seller", nil),
+			wantHeader: `Bearer error="insufficient_scope", error_description="missing scope", scope="seller"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			WriteError(w, httptest.NewRequest(http.MethodGet, "/", nil), tt.err)
+
+			assert.Equal(t, tt.err.Status, w.Code)
+			assert.Equal(t, tt.wantHeader, w.Header().Get("WWW-Authenticate"))
+			assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+
+			var body problem
+			assert.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+			assert.Equal(t, tt.err.Status, body.Status)
+			assert.Equal(t, tt.err.Code, body.Error)
+			assert.Equal(t, tt.err.Description, body.Detail)
+		})
+	}
+}
+
+func TestOIDC_Auth_errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		want     int
+		wantCode string
+	}{
+		{name: "missing header", want: http.StatusUnauthorized},
+		{name: "malformed header", header: defaultToken, want: http.StatusBadRequest, wantCode: ErrorCodeInvalidRequest},
+		{name: "wrong scheme", header: "Basic " + defaultToken, want: http.StatusBadRequest, wantCode: ErrorCodeInvalidRequest},
+		{name: "invalid token", header: "Bearer " + defaultToken, want: http.StatusUnauthorized, wantCode: ErrorCodeInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := log.NewMockLogger(gomock.NewController(t))
+			logger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+			logger.EXPECT().Warn(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().Do(
+				func(_ interface{}, _ string, fields ...log.Field) {
+					assert.NotContains(t, fields, log.Any("token", defaultToken), "tokens must not be logged")
+				},
+			)
+
+			o := &OIDC{oidcProvider: &fakeOIDCProvider{}, clientID: "wrong client id", logger: logger}
+			handler := o.Auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			// error handler set after Auth is used.
+			var got *AuthError
+			o.WithErrorHandler(func(w http.ResponseWriter, r *http.Request, err *AuthError) {
+				got = err
+				WriteError(w, r, err)
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.want, w.Code)
+			if assert.NotNil(t, got) {
+				assert.Equal(t, tt.wantCode, got.Code)
+			}
+			assert.NotContains(t, w.Body.String(), defaultToken)
+		})
+	}
+}
+
+func TestOnError(t *testing.T) {
+	var got []string
+	onError := OnError(func(w http.ResponseWriter, r *http.Request, err *AuthError) {
+		got = append(got, err.Description)
+		w.WriteHeader(err.Status)
+	})
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	middlewares := []func(http.Handler) http.Handler{
+		HasRoleMiddleware("admin", onError),
+		HasRoleAtMiddleware(RolesClaimPath, "admin", onError),
+		HasClientRoleMiddleware("sellers-backend", "refund", onError),
+		HasScopeMiddleware("seller", onError),
+		Require(warnLogger(t), Role("admin"), onError),
+	}
+	for _, mw := range middlewares {
+		w := httptest.NewRecorder()
+		mw(next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	assert.Equal(t, []string{
+		"authentication required",
+		"authentication required",
+		"authentication required",
+		"authentication required",
+		"authentication required",
+	}, got)
+}
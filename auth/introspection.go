@@ -0,0 +1,266 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/facily-tech/go-core/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultIntrospectionMaxCacheTTL = 5 * time.Minute
+	introspectionCachePrefix        = "auth:introspection:"
+)
+
+var (
+	// ErrNoIntrospectionURL error when introspection endpoint is not given.
+	ErrNoIntrospectionURL = errors.New("introspection url cannot be empty")
+	// ErrInactiveToken error when provider reports token as not active.
+	ErrInactiveToken = errors.New("token is not active")
+
+	errCacheMiss = errors.New("key does not exist")
+)
+
+// IntrospectionCache stores introspection results, cache.ClientI satisfies
+// it, so redis may be shared between replicas. Any Get error is treated as a
+// cache miss.
+type IntrospectionCache interface {
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	Get(ctx context.Context, key string) (string, error)
+}
+
+// IntrospectionConfig configures NewIntrospector.
+type IntrospectionConfig struct {
+	// URL of the provider introspection endpoint, for keycloak it is
+	// {issuer}/protocol/openid-connect/token/introspect.
+	URL string
+	// ClientID and ClientSecret authenticate the introspection request.
+	ClientID     string
+	ClientSecret string
+	// Cache stores active tokens until their exp, default in memory.
+	Cache IntrospectionCache
+	// MaxCacheTTL limits how long an active token is cached, also used for
+	// tokens without exp, default 5m. Negative disables caching.
+	MaxCacheTTL time.Duration
+	// HTTPClient used to call URL, default http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Introspector authenticates opaque access tokens using the provider token
+// introspection endpoint (RFC 7662). Introspection response is used as token
+// claims, so HasRole, HasScope and policies work as they do with OIDC.
+type Introspector struct {
+	config       IntrospectionConfig
+	logger       log.Logger
+	errorHandler ErrorHandler
+	revocation   RevocationChecker
+}
+
+// NewIntrospector returns an Introspector calling config.URL.
+func NewIntrospector(logger log.Logger, config IntrospectionConfig) (*Introspector, error) {
+	if config.URL == "" {
+		return nil, errors.WithStack(ErrNoIntrospectionURL)
+	}
+	if config.MaxCacheTTL == 0 {
+		config.MaxCacheTTL = defaultIntrospectionMaxCacheTTL
+	}
+	if config.Cache == nil {
+		config.Cache = newMemoryCache()
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+
+	return &Introspector{
+		config:       config,
+		logger:       logger,
+		errorHandler: nil,
+		revocation:   nil,
+	}, nil
+}
+
+// Auth is a middleware used to validate authorization token by introspection
+// and populate context with its claims. Error handler and revocation are read
+// at request time, so they can be set after Auth.
+func (i *Introspector) Auth(next http.Handler) http.Handler {
+	return authHandler(i.logger, i.onError, i.authenticate, next)
+}
+
+func (i *Introspector) onError(w http.ResponseWriter, r *http.Request, err *AuthError) {
+	errorHandler(i.errorHandler)(w, r, err)
+}
+
+func (i *Introspector) authenticate(ctx context.Context, rawToken string) (Claims, error) {
+	return checkRevocation(i.Introspect, i.revocation)(ctx, rawToken)
+}
+
+// WithRevocation makes Auth reject tokens revoked at checker, like a
+// Denylist, even while their introspection is cached.
+func (i *Introspector) WithRevocation(checker RevocationChecker) {
+	i.revocation = checker
+}
+
+// WithErrorHandler change how Auth writes failures, default is
+// DefaultErrorHandler.
+func (i *Introspector) WithErrorHandler(h ErrorHandler) {
+	i.errorHandler = h
+}
+
+// Introspect returns the claims of rawToken if provider reports it as active.
+// Active tokens are cached until their exp, limited by MaxCacheTTL, inactive
+// tokens are never cached.
+func (i *Introspector) Introspect(ctx context.Context, rawToken string) (Claims, error) {
+	key := introspectionCacheKey(rawToken)
+
+	if i.config.MaxCacheTTL > 0 {
+		if raw, err := i.config.Cache.Get(ctx, key); err == nil {
+			claims := Claims{}
+			if err := json.Unmarshal([]byte(raw), &claims); err == nil && !expired(claims, time.Now()) {
+				return claims, nil
+			}
+		}
+	}
+
+	claims, err := i.introspect(ctx, rawToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if ttl := i.cacheTTL(claims, time.Now()); ttl > 0 {
+		raw, err := json.Marshal(claims)
+		if err == nil {
+			err = i.config.Cache.Set(ctx, key, string(raw), ttl)
+		}
+		if err != nil {
+			i.logger.Warn(ctx, "auth: cannot cache introspection", log.Error(err))
+		}
+	}
+
+	return claims, nil
+}
+
+func (i *Introspector) introspect(ctx context.Context, rawToken string) (Claims, error) {
+	form := url.Values{"token": {rawToken}, "token_type_hint": {"access_token"}}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.config.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create introspection request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(i.config.ClientID), url.QueryEscape(i.config.ClientSecret))
+
+	resp, err := i.config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot introspect token")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("cannot introspect token, status code %d", resp.StatusCode)
+	}
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read introspection")
+	}
+
+	claims := Claims{}
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return nil, errors.Wrap(err, "cannot parse introspection")
+	}
+
+	if active, _ := claims["active"].(bool); !active || expired(claims, time.Now()) {
+		return nil, errors.WithStack(ErrInactiveToken)
+	}
+
+	return claims, nil
+}
+
+// cacheTTL returns how long claims may be cached, zero if they must not.
+func (i *Introspector) cacheTTL(claims Claims, now time.Time) time.Duration {
+	ttl := i.config.MaxCacheTTL
+	if exp := claims.ExpiresAt(); !exp.IsZero() {
+		if untilExp := exp.Sub(now); untilExp < ttl {
+			ttl = untilExp
+		}
+	}
+
+	return ttl
+}
+
+// expired returns true if claims has an exp before now.
+func expired(claims Claims, now time.Time) bool {
+	exp := claims.ExpiresAt()
+
+	return !exp.IsZero() && !now.Before(exp)
+}
+
+// introspectionCacheKey hashes rawToken, so tokens are never stored in cache.
+func introspectionCacheKey(rawToken string) string {
+	sum := sha256.Sum256([]byte(rawToken))
+
+	return introspectionCachePrefix + hex.EncodeToString(sum[:])
+}
+
+type memoryCacheEntry struct {
+	value     string
+	expiresAt time.Time
+}
+
+// memoryCache is the default IntrospectionCache, expired entries are removed
+// once per minute while setting new ones.
+type memoryCache struct {
+	mu        sync.Mutex
+	entries   map[string]memoryCacheEntry
+	lastSweep time.Time
+}
+
+func newMemoryCache() *memoryCache {
+	return &memoryCache{
+		mu:        sync.Mutex{},
+		entries:   map[string]memoryCacheEntry{},
+		lastSweep: time.Now(),
+	}
+}
+
+func (c *memoryCache) Set(_ context.Context, key, value string, ttl time.Duration) error {
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.lastSweep) >= time.Minute {
+		for k, e := range c.entries {
+			if !now.Before(e.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		c.lastSweep = now
+	}
+
+	c.entries[key] = memoryCacheEntry{value: value, expiresAt: now.Add(ttl)}
+
+	return nil
+}
+
+func (c *memoryCache) Get(_ context.Context, key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || !time.Now().Before(e.expiresAt) {
+		return "", errCacheMiss
+	}
+
+	return e.value, nil
+}
@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/facily-tech/go-core/log"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newIntrospectionServer answers introspection of token with response,
+// other tokens are reported as not active.
+func newIntrospectionServer(t *testing.T, token string, response map[string]interface{}) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "sellers-backend" || secret != "s3cr3t" {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		assert.NoError(t, r.ParseForm())
+		if r.PostForm.Get("token") != token {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"active": false})
+
+			return
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &calls
+}
+
+func TestIntrospector_Introspect(t *testing.T) {
+	exp := float64(time.Now().Add(time.Hour).Unix())
+	srv, calls := newIntrospectionServer(t, "opaque", map[string]interface{}{
+		"active": true,
+		"sub":    "user-1",
+		"scope":  "openid seller",
+		"exp":    exp,
+	})
+
+	i, err := NewIntrospector(log.NewMockLogger(gomock.NewController(t)), IntrospectionConfig{
+		URL:          srv.URL,
+		ClientID:     "sellers-backend",
+		ClientSecret: "s3cr3t",
+	})
+	require.NoError(t, err)
+
+	claims, err := i.Introspect(context.Background(), "opaque")
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", claims.Subject())
+	assert.True(t, claims.HasScope("seller"))
+
+	// cached until exp
+	_, err = i.Introspect(context.Background(), "opaque")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+
+	// inactive tokens are not cached
+	for n := 0; n < 2; n++ {
+		_, err = i.Introspect(context.Background(), "revoked")
+		assert.ErrorIs(t, err, ErrInactiveToken)
+	}
+	assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+}
+
+func TestIntrospector_Introspect_errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		response map[string]interface{}
+		secret   string
+		want     error
+	}{
+		{
+			name:     "expired",
+			response: map[string]interface{}{"active": true, "exp": float64(time.Now().Add(-time.Minute).Unix())},
+			secret:   "s3cr3t",
+			want:     ErrInactiveToken,
+		},
+		{
+			name:     "active absent",
+			response: map[string]interface{}{"sub": "user-1"},
+			secret:   "s3cr3t",
+			want:     ErrInactiveToken,
+		},
+		{
+			name:     "wrong client credentials",
+			response: map[string]interface{}{"active": true},
+			secret:   "wrong",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := newIntrospectionServer(t, "opaque", tt.response)
+			i, err := NewIntrospector(log.NewMockLogger(gomock.NewController(t)), IntrospectionConfig{
+				URL:          srv.URL,
+				ClientID:     "sellers-backend",
+				ClientSecret: tt.secret,
+			})
+			require.NoError(t, err)
+
+			_, err = i.Introspect(context.Background(), "opaque")
+			assert.Error(t, err)
+			if tt.want != nil {
+				assert.ErrorIs(t, err, tt.want)
+			}
+		})
+	}
+}
+
+type fakeCache map[string]string
+
+func (c fakeCache) Set(_ context.Context, key, value string, _ time.Duration) error {
+	c[key] = value
+
+	return nil
+}
+
+func (c fakeCache) Get(_ context.Context, key string) (string, error) {
+	v, ok := c[key]
+	if !ok {
+		return "", errCacheMiss
+	}
+
+	return v, nil
+}
+
+func TestIntrospector_cache(t *testing.T) {
+	srv, calls := newIntrospectionServer(t, "opaque", map[string]interface{}{"active": true, "sub": "user-1"})
+	cache := fakeCache{}
+
+	i, err := NewIntrospector(log.NewMockLogger(gomock.NewController(t)), IntrospectionConfig{
+		URL:          srv.URL,
+		ClientID:     "sellers-backend",
+		ClientSecret: "s3cr3t",
+		Cache:        cache,
+	})
+	require.NoError(t, err)
+
+	_, err = i.Introspect(context.Background(), "opaque")
+	require.NoError(t, err)
+
+	// a replica sharing the cache does not call the provider
+	other, err := NewIntrospector(log.NewMockLogger(gomock.NewController(t)), IntrospectionConfig{
+		URL:   srv.URL,
+		Cache: cache,
+	})
+	require.NoError(t, err)
+	claims, err := other.Introspect(context.Background(), "opaque")
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", claims.Subject())
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+
+	assert.Len(t, cache, 1)
+	for key := range cache {
+		assert.NotContains(t, key, "opaque")
+	}
+}
+
+func TestIntrospector_Auth(t *testing.T) {
+	srv, _ := newIntrospectionServer(t, "opaque", map[string]interface{}{
+		"active":       true,
+		"realm_access": map[string]interface{}{"roles": []interface{}{"view"}},
+	})
+
+	logger := log.NewMockLogger(gomock.NewController(t))
+	// opaque tokens are live credentials, they must never be logged.
+	logger.EXPECT().Warn(gomock.Any(), "auth: invalid token", gomock.Any()).Times(1).Do(
+		func(_ context.Context, _ string, fields ...log.Field) {
+			assert.NotContains(t, fmt.Sprint(fields), "inactive-opaque")
+		},
+	)
+	i, err := NewIntrospector(logger, IntrospectionConfig{
+		URL:          srv.URL,
+		ClientID:     "sellers-backend",
+		ClientSecret: "s3cr3t",
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{name: "active", token: "opaque", want: http.StatusOK},
+		{name: "inactive", token: "inactive-opaque", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+
+			i.Auth(HasRoleMiddleware("view")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))).ServeHTTP(w, r)
+
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+}
+
+func TestNewIntrospector(t *testing.T) {
+	_, err := NewIntrospector(log.NewMockLogger(gomock.NewController(t)), IntrospectionConfig{})
+	assert.ErrorIs(t, err, ErrNoIntrospectionURL)
+}
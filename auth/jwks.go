@@ -0,0 +1,367 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	oidc "github.com/coreos/go-oidc"
+	"github.com/facily-tech/go-core/log"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+const (
+	defaultRefreshInterval    = time.Hour
+	defaultMinRefreshInterval = time.Minute
+)
+
+var (
+	// ErrNoKeys error when there is no way to obtain keys to verify tokens.
+	ErrNoKeys = errors.New("no jwks or jwks url given")
+	// ErrUnknownKey error when no key is able to verify token signature.
+	ErrUnknownKey = errors.New("no key verifies token signature")
+	// ErrNoIssuer error when issuer is neither given nor present at discovery document.
+	ErrNoIssuer = errors.New("issuer cannot be empty")
+)
+
+var _ oidc.KeySet = (*KeySet)(nil)
+
+// KeySetConfig configures where KeySet loads keys from. Initial keys are read
+// from JWKS, JWKSFile or JWKSEnv, in this order, and URL is used to refresh
+// them.
+type KeySetConfig struct {
+	// JWKS is a JSON Web Key Set document.
+	JWKS []byte
+	// JWKSFile is the path of a JSON Web Key Set document.
+	JWKSFile string
+	// JWKSEnv is the name of an environment variable holding a JSON Web Key Set document.
+	JWKSEnv string
+	// URL of the issuer JSON Web Key Set, keys are refreshed from it.
+	URL string
+	// RefreshInterval between background refreshes from URL, default 1h.
+	// Negative disables background refresh.
+	RefreshInterval time.Duration
+	// MinRefreshInterval is the minimum wait between refreshes triggered by
+	// tokens signed with unknown keys, default 1m.
+	MinRefreshInterval time.Duration
+	// HTTPClient used to fetch URL, default http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// KeySet verifies token signatures using a JSON Web Key Set. Keys are
+// refreshed from URL in background and when a token is signed by an unknown
+// key, so issuer key rotation is handled. If a refresh fails the last known
+// good keys are kept.
+type KeySet struct {
+	config KeySetConfig
+	logger log.Logger
+
+	mu          sync.RWMutex
+	keys        []jose.JSONWebKey
+	lastRefresh time.Time
+
+	refreshMu sync.Mutex
+	// refreshes counts finished refreshes, so tokens waiting refreshMu do not
+	// refresh again.
+	refreshes uint64
+}
+
+// NewKeySet creates a KeySet using config, it do not require URL to be
+// available. Background refresh stops when ctx is done.
+func NewKeySet(ctx context.Context, logger log.Logger, config KeySetConfig) (*KeySet, error) {
+	if config.RefreshInterval == 0 {
+		config.RefreshInterval = defaultRefreshInterval
+	}
+	if config.MinRefreshInterval == 0 {
+		config.MinRefreshInterval = defaultMinRefreshInterval
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+
+	k := &KeySet{
+		config:      config,
+		logger:      logger,
+		mu:          sync.RWMutex{},
+		keys:        nil,
+		lastRefresh: time.Time{},
+		refreshMu:   sync.Mutex{},
+		refreshes:   0,
+	}
+
+	raw, err := config.initialJWKS()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case raw != nil:
+		keys, err := parseJWKS(raw)
+		if err != nil {
+			return nil, err
+		}
+		k.keys = keys
+	case config.URL == "":
+		return nil, errors.WithStack(ErrNoKeys)
+	default:
+		if err := k.Refresh(ctx); err != nil {
+			logger.Warn(ctx, "auth: cannot load jwks, retrying on first token", log.Error(err))
+		}
+	}
+
+	if config.URL != "" && config.RefreshInterval > 0 {
+		go k.run(ctx)
+	}
+
+	return k, nil
+}
+
+func (c KeySetConfig) initialJWKS() ([]byte, error) {
+	switch {
+	case c.JWKS != nil:
+		return c.JWKS, nil
+	case c.JWKSFile != "":
+		raw, err := os.ReadFile(c.JWKSFile)
+
+		return raw, errors.Wrap(err, "cannot read jwks file")
+	case c.JWKSEnv != "":
+		if raw, ok := os.LookupEnv(c.JWKSEnv); ok {
+			return []byte(raw), nil
+		}
+	}
+
+	return nil, nil
+}
+
+func parseJWKS(raw []byte) ([]jose.JSONWebKey, error) {
+	var set jose.JSONWebKeySet
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, errors.Wrap(err, "cannot parse jwks")
+	}
+	if len(set.Keys) == 0 {
+		return nil, errors.Wrap(ErrNoKeys, "empty jwks")
+	}
+
+	return set.Keys, nil
+}
+
+// VerifySignature verifies jwt signature and returns its payload, if no key
+// matches it, keys are refreshed once and verification retried.
+func (k *KeySet) VerifySignature(ctx context.Context, jwt string) ([]byte, error) {
+	jws, err := jose.ParseSigned(jwt)
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed jwt")
+	}
+
+	payload, err := k.verify(jws)
+	if err == nil || !errors.Is(err, ErrUnknownKey) || !k.canRefresh() {
+		return payload, err
+	}
+
+	if err := k.refreshUnknown(ctx); err != nil {
+		k.logger.Warn(ctx, "auth: cannot refresh jwks, using last known keys", log.Error(err))
+	}
+
+	return k.verify(jws)
+}
+
+// PublicKey returns the signing key identified by kid, if it's unknown keys
+// are refreshed once. Empty kid returns the key only if there is a single one.
+// It lets other token parsers, like http/server/middleware JWTConfig, share
+// keys and refreshes.
+func (k *KeySet) PublicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	key, err := k.publicKey(kid)
+	if err == nil || !k.canRefresh() {
+		return key, err
+	}
+
+	if err := k.refreshUnknown(ctx); err != nil {
+		k.logger.Warn(ctx, "auth: cannot refresh jwks, using last known keys", log.Error(err))
+	}
+
+	return k.publicKey(kid)
+}
+
+func (k *KeySet) publicKey(kid string) (crypto.PublicKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	var found crypto.PublicKey
+	for i := range k.keys {
+		key := &k.keys[i]
+		if key.Use == "enc" || !key.Valid() || (kid != "" && key.KeyID != kid) {
+			continue
+		}
+		if kid != "" {
+			return key.Public().Key, nil
+		}
+		if found != nil {
+			return nil, errors.Wrap(ErrUnknownKey, "token without kid and many keys")
+		}
+		found = key.Public().Key
+	}
+	if found == nil {
+		return nil, errors.Wrapf(ErrUnknownKey, "kid %q", kid)
+	}
+
+	return found, nil
+}
+
+// refreshUnknown refreshes keys for a token signed by an unknown key,
+// concurrent tokens wait for a single refresh.
+func (k *KeySet) refreshUnknown(ctx context.Context) error {
+	seen := atomic.LoadUint64(&k.refreshes)
+
+	k.refreshMu.Lock()
+	defer k.refreshMu.Unlock()
+
+	if atomic.LoadUint64(&k.refreshes) != seen || !k.canRefresh() {
+		return nil
+	}
+
+	return k.refreshLocked(ctx)
+}
+
+func (k *KeySet) verify(jws *jose.JSONWebSignature) ([]byte, error) {
+	kid := ""
+	if len(jws.Signatures) > 0 {
+		kid = jws.Signatures[0].Header.KeyID
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	for i := range k.keys {
+		if kid != "" && k.keys[i].KeyID != kid {
+			continue
+		}
+
+		if payload, err := jws.Verify(&k.keys[i]); err == nil {
+			return payload, nil
+		}
+	}
+
+	return nil, errors.Wrapf(ErrUnknownKey, "kid %q", kid)
+}
+
+// canRefresh returns true if URL is known and last refresh is older than
+// MinRefreshInterval.
+func (k *KeySet) canRefresh() bool {
+	if k.config.URL == "" {
+		return false
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return time.Since(k.lastRefresh) >= k.config.MinRefreshInterval
+}
+
+// Refresh fetch keys from URL, on failure current keys are kept.
+func (k *KeySet) Refresh(ctx context.Context) error {
+	k.refreshMu.Lock()
+	defer k.refreshMu.Unlock()
+
+	return k.refreshLocked(ctx)
+}
+
+func (k *KeySet) refreshLocked(ctx context.Context) error {
+	defer atomic.AddUint64(&k.refreshes, 1)
+
+	keys, err := k.fetch(ctx)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	// while there are no keys every token fails, the next one retries.
+	if err == nil || len(k.keys) > 0 {
+		k.lastRefresh = time.Now()
+	}
+	if err != nil {
+		return err
+	}
+	k.keys = keys
+
+	return nil
+}
+
+func (k *KeySet) fetch(ctx context.Context) ([]jose.JSONWebKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.config.URL, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create jwks request")
+	}
+
+	resp, err := k.config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot fetch jwks")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("cannot fetch jwks, status code %d", resp.StatusCode)
+	}
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read jwks")
+	}
+
+	return parseJWKS(raw)
+}
+
+func (k *KeySet) run(ctx context.Context) {
+	t := time.NewTicker(k.config.RefreshInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := k.Refresh(ctx); err != nil {
+				k.logger.Warn(ctx, "auth: cannot refresh jwks, using last known keys", log.Error(err))
+			}
+		}
+	}
+}
+
+// discovery is the subset of openid discovery document used by auth.
+type discovery struct {
+	Issuer   string `json:"issuer"`
+	AuthURL  string `json:"authorization_endpoint"`
+	TokenURL string `json:"token_endpoint"`
+	JWKSURL  string `json:"jwks_uri"`
+	// Algorithms used by the issuer to sign tokens, go-oidc accepts only
+	// RS256 without them.
+	Algorithms []string `json:"id_token_signing_alg_values_supported"`
+}
+
+// keySetProvider implements oidcProvider without network discovery.
+type keySetProvider struct {
+	discovery
+	keySet oidc.KeySet
+}
+
+// Verifier uses discovery algorithms when config has none, like
+// oidc.Provider.Verifier.
+func (p *keySetProvider) Verifier(config *oidc.Config) *oidc.IDTokenVerifier {
+	if len(config.SupportedSigningAlgs) == 0 && len(p.Algorithms) > 0 {
+		c := *config
+		c.SupportedSigningAlgs = p.Algorithms
+		config = &c
+	}
+
+	return oidc.NewVerifier(p.Issuer, p.keySet, config)
+}
+
+func (p *keySetProvider) Endpoint() oauth2.Endpoint {
+	return oauth2.Endpoint{AuthURL: p.AuthURL, TokenURL: p.TokenURL, AuthStyle: oauth2.AuthStyleAutoDetect}
+}
@@ -0,0 +1,345 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/facily-tech/go-core/log"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+type testKey struct {
+	private *rsa.PrivateKey
+	kid     string
+}
+
+func newTestKey(t *testing.T, kid string) testKey {
+	t.Helper()
+
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	return testKey{private: private, kid: kid}
+}
+
+func (k testKey) jwks(t *testing.T) []byte {
+	t.Helper()
+
+	raw, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+		Key:       &k.private.PublicKey,
+		KeyID:     k.kid,
+		Algorithm: string(jose.RS256),
+		Use:       "sig",
+	}}})
+	require.NoError(t, err)
+
+	return raw
+}
+
+func (k testKey) sign(t *testing.T, claims Claims) string {
+	t.Helper()
+
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: k.private},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", k.kid),
+	)
+	require.NoError(t, err)
+
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	jws, err := signer.Sign(payload)
+	require.NoError(t, err)
+
+	token, err := jws.CompactSerialize()
+	require.NoError(t, err)
+
+	return token
+}
+
+func warnLogger(t *testing.T) log.Logger {
+	t.Helper()
+
+	l := log.NewMockLogger(gomock.NewController(t))
+	l.EXPECT().Warn(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+
+	return l
+}
+
+func TestNewKeySet(t *testing.T) {
+	key := newTestKey(t, "a")
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(file, key.jwks(t), 0o600))
+	t.Setenv("AUTH_TEST_JWKS", string(key.jwks(t)))
+
+	tests := []struct {
+		name    string
+		config  KeySetConfig
+		wantErr error
+	}{
+		{name: "bytes", config: KeySetConfig{JWKS: key.jwks(t)}},
+		{name: "file", config: KeySetConfig{JWKSFile: file}},
+		{name: "env", config: KeySetConfig{JWKSEnv: "AUTH_TEST_JWKS"}},
+		{name: "no keys", config: KeySetConfig{JWKSEnv: "AUTH_TEST_UNSET"}, wantErr: ErrNoKeys},
+		{name: "empty jwks", config: KeySetConfig{JWKS: []byte(`{"keys": []}`)}, wantErr: ErrNoKeys},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks, err := NewKeySet(context.Background(), warnLogger(t), tt.config)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+
+				return
+			}
+			require.NoError(t, err)
+
+			payload, err := ks.VerifySignature(context.Background(), key.sign(t, Claims{"sub": "123"}))
+			assert.NoError(t, err)
+			assert.JSONEq(t, `{"sub": "123"}`, string(payload))
+		})
+	}
+}
+
+func TestKeySet_VerifySignature(t *testing.T) {
+	oldKey, newKey := newTestKey(t, "old"), newTestKey(t, "new")
+
+	t.Run("unknown key without url", func(t *testing.T) {
+		ks, err := NewKeySet(context.Background(), warnLogger(t), KeySetConfig{JWKS: oldKey.jwks(t)})
+		require.NoError(t, err)
+
+		_, err = ks.VerifySignature(context.Background(), newKey.sign(t, Claims{}))
+		assert.ErrorIs(t, err, ErrUnknownKey)
+	})
+	t.Run("rotated key is fetched", func(t *testing.T) {
+		var fetches int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&fetches, 1)
+			_, _ = w.Write(newKey.jwks(t))
+		}))
+		defer ts.Close()
+
+		ks, err := NewKeySet(context.Background(), warnLogger(t), KeySetConfig{
+			JWKS:               oldKey.jwks(t),
+			URL:                ts.URL,
+			RefreshInterval:    -1,
+			MinRefreshInterval: time.Nanosecond,
+		})
+		require.NoError(t, err)
+
+		_, err = ks.VerifySignature(context.Background(), newKey.sign(t, Claims{}))
+		assert.NoError(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+	})
+	t.Run("concurrent unknown keys refresh once", func(t *testing.T) {
+		var fetches int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&fetches, 1)
+			time.Sleep(10 * time.Millisecond)
+			_, _ = w.Write(newKey.jwks(t))
+		}))
+		defer ts.Close()
+
+		ks, err := NewKeySet(context.Background(), warnLogger(t), KeySetConfig{
+			JWKS:               oldKey.jwks(t),
+			URL:                ts.URL,
+			RefreshInterval:    -1,
+			MinRefreshInterval: time.Nanosecond,
+		})
+		require.NoError(t, err)
+
+		token := newKey.sign(t, Claims{})
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				_, err := ks.VerifySignature(context.Background(), token)
+				assert.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+	})
+	t.Run("last known good keys are kept", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer ts.Close()
+
+		ks, err := NewKeySet(context.Background(), warnLogger(t), KeySetConfig{
+			JWKS:            oldKey.jwks(t),
+			URL:             ts.URL,
+			RefreshInterval: -1,
+		})
+		require.NoError(t, err)
+
+		assert.Error(t, ks.Refresh(context.Background()))
+		_, err = ks.VerifySignature(context.Background(), oldKey.sign(t, Claims{}))
+		assert.NoError(t, err)
+	})
+	t.Run("issuer down at startup", func(t *testing.T) {
+		up := int32(0)
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.LoadInt32(&up) == 0 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			_, _ = w.Write(newKey.jwks(t))
+		}))
+		defer ts.Close()
+
+		// failed fetches without keys do not delay the next one.
+		ks, err := NewKeySet(context.Background(), warnLogger(t), KeySetConfig{
+			URL:             ts.URL,
+			RefreshInterval: -1,
+		})
+		require.NoError(t, err)
+
+		atomic.StoreInt32(&up, 1)
+		_, err = ks.VerifySignature(context.Background(), newKey.sign(t, Claims{}))
+		assert.NoError(t, err)
+	})
+}
+
+func TestKeySet_PublicKey(t *testing.T) {
+	oldKey, newKey := newTestKey(t, "old"), newTestKey(t, "new")
+
+	var fetches int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		_, _ = w.Write(newKey.jwks(t))
+	}))
+	defer ts.Close()
+
+	ks, err := NewKeySet(context.Background(), warnLogger(t), KeySetConfig{
+		JWKS:               oldKey.jwks(t),
+		URL:                ts.URL,
+		RefreshInterval:    -1,
+		MinRefreshInterval: time.Hour,
+	})
+	require.NoError(t, err)
+
+	key, err := ks.PublicKey(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Equal(t, &oldKey.private.PublicKey, key)
+
+	key, err = ks.PublicKey(context.Background(), "new")
+	assert.NoError(t, err)
+	assert.Equal(t, &newKey.private.PublicKey, key)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+
+	// refreshes are limited by MinRefreshInterval.
+	_, err = ks.PublicKey(context.Background(), "unknown")
+	assert.ErrorIs(t, err, ErrUnknownKey)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+}
+
+func TestNewOffline(t *testing.T) {
+	key := newTestKey(t, "a")
+	issuer := "http://localhost:8080/realms/finance"
+	discovery := []byte(`{
+		"issuer": "` + issuer + `",
+		"token_endpoint": "` + issuer + `/protocol/openid-connect/token",
+		"jwks_uri": "http://localhost:1/unreachable"
+	}`)
+
+	t.Run("success", func(t *testing.T) {
+		o, err := NewOffline(context.Background(), warnLogger(t), OfflineConfig{
+			ClientID:  "client",
+			Discovery: discovery,
+			KeySet:    KeySetConfig{JWKS: key.jwks(t), RefreshInterval: -1},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, issuer+"/protocol/openid-connect/token", o.Endpoint().TokenURL)
+
+		token := key.sign(t, Claims{
+			"iss": issuer,
+			"aud": "client",
+			"sub": "123",
+			"exp": time.Now().Add(time.Minute).Unix(),
+		})
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Add("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+
+		var sub interface{}
+		o.Auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sub = GetRootClaim(r.Context(), "sub")
+		})).ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "123", sub)
+	})
+	t.Run("ES256 listed at discovery", func(t *testing.T) {
+		private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		jwks, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+			Key:       &private.PublicKey,
+			KeyID:     "ec",
+			Algorithm: string(jose.ES256),
+			Use:       "sig",
+		}}})
+		require.NoError(t, err)
+
+		o, err := NewOffline(context.Background(), warnLogger(t), OfflineConfig{
+			ClientID: "client",
+			Discovery: []byte(`{
+				"issuer": "` + issuer + `",
+				"id_token_signing_alg_values_supported": ["RS256", "ES256"]
+			}`),
+			KeySet: KeySetConfig{JWKS: jwks, RefreshInterval: -1},
+		})
+		require.NoError(t, err)
+
+		signer, err := jose.NewSigner(
+			jose.SigningKey{Algorithm: jose.ES256, Key: private},
+			(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "ec"),
+		)
+		require.NoError(t, err)
+		payload, err := json.Marshal(Claims{"iss": issuer, "aud": "client", "sub": "123", "exp": time.Now().Add(time.Minute).Unix()})
+		require.NoError(t, err)
+		jws, err := signer.Sign(payload)
+		require.NoError(t, err)
+		token, err := jws.CompactSerialize()
+		require.NoError(t, err)
+
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Add("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+
+		o.Auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+	t.Run("no issuer", func(t *testing.T) {
+		_, err := NewOffline(context.Background(), warnLogger(t), OfflineConfig{
+			ClientID: "client",
+			KeySet:   KeySetConfig{JWKS: key.jwks(t)},
+		})
+		assert.ErrorIs(t, err, ErrNoIssuer)
+	})
+	t.Run("invalid discovery", func(t *testing.T) {
+		_, err := NewOffline(context.Background(), warnLogger(t), OfflineConfig{
+			Discovery: []byte("{"),
+		})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/facily-tech/go-core/log"
+	"github.com/pkg/errors"
+)
+
+const jwtParts = 3
+
+var (
+	// ErrUnknownIssuer error when token issuer is not allowed.
+	ErrUnknownIssuer = errors.New("token issuer not allowed")
+	// ErrMalformedToken error when token is not a jwt.
+	ErrMalformedToken = errors.New("malformed token")
+)
+
+// MultiOIDC validates tokens from many issuers, like one keycloak realm for
+// staff and another for partners. Each token is verified by the OIDC of its
+// issuer, so each issuer has its own client id, tokens from issuers not
+// registered are rejected.
+type MultiOIDC struct {
+	issuers      map[string]*OIDC
+	logger       log.Logger
+	errorHandler ErrorHandler
+	revocation   RevocationChecker
+}
+
+// NewMulti returns a MultiOIDC allowing only issuers keys, each created using
+// New or NewOffline with the issuer expected client id. Revocation set at an
+// issuer OIDC is checked for its tokens, besides MultiOIDC one, while only
+// MultiOIDC error handler is used.
+func NewMulti(log log.Logger, issuers map[string]*OIDC) *MultiOIDC {
+	allowed := make(map[string]*OIDC, len(issuers))
+	for iss, o := range issuers {
+		allowed[iss] = o
+	}
+
+	return &MultiOIDC{
+		issuers:      allowed,
+		logger:       log,
+		errorHandler: nil,
+		revocation:   nil,
+	}
+}
+
+// Auth is a middleware used to validate authorization token, using the OIDC
+// of token issuer, and populate context with stardard claims. Error handler and
+// revocation are read at request time, so they can be set after Auth.
+func (m *MultiOIDC) Auth(next http.Handler) http.Handler {
+	return authHandler(m.logger, m.onError, m.authenticate, next)
+}
+
+func (m *MultiOIDC) onError(w http.ResponseWriter, r *http.Request, err *AuthError) {
+	errorHandler(m.errorHandler)(w, r, err)
+}
+
+func (m *MultiOIDC) authenticate(ctx context.Context, rawToken string) (Claims, error) {
+	return checkRevocation(m.issuerAuthenticate, m.revocation)(ctx, rawToken)
+}
+
+// issuerAuthenticate authenticates rawToken using the OIDC of its issuer,
+// including its revocation checker.
+func (m *MultiOIDC) issuerAuthenticate(ctx context.Context, rawToken string) (Claims, error) {
+	iss, err := unverifiedIssuer(rawToken)
+	if err != nil {
+		return nil, err
+	}
+
+	o, ok := m.issuers[iss]
+	if !ok {
+		return nil, errors.Wrapf(ErrUnknownIssuer, "issuer %q", iss)
+	}
+
+	return o.authenticate(ctx, rawToken)
+}
+
+// WithRevocation makes Auth reject tokens revoked at checker, like a
+// Denylist, after verifying them.
+func (m *MultiOIDC) WithRevocation(checker RevocationChecker) {
+	m.revocation = checker
+}
+
+// WithErrorHandler change how Auth writes failures, default is
+// DefaultErrorHandler.
+func (m *MultiOIDC) WithErrorHandler(h ErrorHandler) {
+	m.errorHandler = h
+}
+
+// Issuer returns the OIDC used to validate tokens from issuer, if allowed.
+func (m *MultiOIDC) Issuer(issuer string) (*OIDC, bool) {
+	o, ok := m.issuers[issuer]
+
+	return o, ok
+}
+
+// unverifiedIssuer returns iss claim without verifying token signature, it
+// must only be used to choose how to verify token.
+func unverifiedIssuer(rawToken string) (string, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != jwtParts {
+		return "", errors.Wrapf(ErrMalformedToken, "expected %d parts got %d", jwtParts, len(parts))
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errors.Wrap(ErrMalformedToken, err.Error())
+	}
+
+	var claims struct {
+		Issuer string `json:"iss"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", errors.Wrap(ErrMalformedToken, err.Error())
+	}
+
+	return claims.Issuer, nil
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiOIDC_Auth(t *testing.T) {
+	const (
+		staff   = "http://localhost:8080/realms/staff"
+		partner = "http://localhost:8080/realms/partner"
+	)
+	staffKey, partnerKey := newTestKey(t, "staff"), newTestKey(t, "partner")
+
+	newOIDC := func(issuer, clientID string, key testKey) *OIDC {
+		o, err := NewOffline(context.Background(), warnLogger(t), OfflineConfig{
+			ClientID: clientID,
+			Issuer:   issuer,
+			KeySet:   KeySetConfig{JWKS: key.jwks(t)},
+		})
+		require.NoError(t, err)
+
+		return o
+	}
+	staffOIDC := newOIDC(staff, "backoffice", staffKey)
+	denylist := NewMemoryDenylist()
+	require.NoError(t, denylist.RevokeSession(context.Background(), "logged-out", time.Minute))
+	staffOIDC.WithRevocation(denylist)
+
+	m := NewMulti(warnLogger(t), map[string]*OIDC{
+		staff:   staffOIDC,
+		partner: newOIDC(partner, "partners-api", partnerKey),
+	})
+
+	exp := time.Now().Add(time.Minute).Unix()
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{
+			name:  "staff token",
+			token: staffKey.sign(t, Claims{"iss": staff, "aud": "backoffice", "exp": exp}),
+			want:  http.StatusOK,
+		},
+		{
+			name:  "staff token revoked at staff OIDC",
+			token: staffKey.sign(t, Claims{"iss": staff, "aud": "backoffice", "sid": "logged-out", "exp": exp}),
+			want:  http.StatusUnauthorized,
+		},
+		{
+			name:  "partner token",
+			token: partnerKey.sign(t, Claims{"iss": partner, "aud": "partners-api", "exp": exp}),
+			want:  http.StatusOK,
+		},
+		{
+			name:  "partner audience at staff issuer",
+			token: staffKey.sign(t, Claims{"iss": staff, "aud": "partners-api", "exp": exp}),
+			want:  http.StatusUnauthorized,
+		},
+		{
+			name:  "issuer signed by other issuer key",
+			token: partnerKey.sign(t, Claims{"iss": staff, "aud": "backoffice", "exp": exp}),
+			want:  http.StatusUnauthorized,
+		},
+		{
+			name:  "issuer not allowed",
+			token: staffKey.sign(t, Claims{"iss": "http://evil", "aud": "backoffice", "exp": exp}),
+			want:  http.StatusUnauthorized,
+		},
+		{
+			name:  "malformed token",
+			token: "abc",
+			want:  http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Add("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+
+			m.Auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+}
+
+func TestUnverifiedIssuer(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   string
+		want    string
+		wantErr bool
+	}{
+		{name: "issuer", token: "e30.eyJpc3MiOiJodHRwOi8vbG9jYWxob3N0In0.sig", want: "http://localhost"},
+		{name: "no issuer", token: "e30.e30.sig", want: ""},
+		{name: "parts", token: "e30.e30", wantErr: true},
+		{name: "base64", token: "e30.!.sig", wantErr: true},
+		{name: "json", token: "e30.bm90IGpzb24.sig", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := unverifiedIssuer(tt.token)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrMalformedToken)
+
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -5,6 +5,7 @@ package auth
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"strings"
 	"time"
@@ -32,8 +33,10 @@ const (
 // dependencies like logger.
 type OIDC struct {
 	oidcProvider
-	clientID string
-	logger   log.Logger
+	clientID     string
+	logger       log.Logger
+	errorHandler ErrorHandler
+	revocation   RevocationChecker
 }
 
 // oidcProvider required interface of oidc dependecy.
@@ -57,142 +60,234 @@ func New(log log.Logger, clientID, issuer string) (*OIDC, error) {
 	}, nil
 }
 
+// OfflineConfig configures NewOffline.
+type OfflineConfig struct {
+	// ClientID expected at token audience.
+	ClientID string
+	// Issuer expected at token, it may be omitted if Discovery is given.
+	Issuer string
+	// Discovery is a cached openid discovery document
+	// (.well-known/openid-configuration), used to fill Issuer, endpoints and
+	// KeySet.URL.
+	Discovery []byte
+	// KeySet configures where keys are loaded from.
+	KeySet KeySetConfig
+}
+
+// NewOffline returns a new OIDC like New, but without network discovery at
+// startup. Keys are loaded from a static JWKS and refreshed from issuer in
+// background while ctx is not done, see KeySet.
+func NewOffline(ctx context.Context, log log.Logger, config OfflineConfig) (*OIDC, error) {
+	var d discovery
+	if config.Discovery != nil {
+		if err := json.Unmarshal(config.Discovery, &d); err != nil {
+			return nil, errors.Wrap(err, "cannot parse discovery document")
+		}
+	}
+	if config.Issuer != "" {
+		d.Issuer = config.Issuer
+	}
+	if d.Issuer == "" {
+		return nil, errors.WithStack(ErrNoIssuer)
+	}
+	if config.KeySet.URL == "" {
+		config.KeySet.URL = d.JWKSURL
+	}
+
+	keySet, err := NewKeySet(ctx, log, config.KeySet)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create key set")
+	}
+
+	return &OIDC{
+		oidcProvider: &keySetProvider{discovery: d, keySet: keySet},
+		logger:       log,
+		clientID:     config.ClientID,
+	}, nil
+}
+
 // Auth is a middleware used to validate authorization token and populate context
-// with stardard claims.
+// with stardard claims. Error handler and revocation are read at request time,
+// so they can be set after Auth.
 func (o *OIDC) Auth(next http.Handler) http.Handler {
+	return authHandler(o.logger, o.onError, o.authenticate, next)
+}
+
+func (o *OIDC) onError(w http.ResponseWriter, r *http.Request, err *AuthError) {
+	errorHandler(o.errorHandler)(w, r, err)
+}
+
+func (o *OIDC) authenticate(ctx context.Context, rawToken string) (Claims, error) {
+	return checkRevocation(idTokenClaims(o.verify), o.revocation)(ctx, rawToken)
+}
+
+// WithRevocation makes Auth reject tokens revoked at checker, like a
+// Denylist, after verifying them.
+func (o *OIDC) WithRevocation(checker RevocationChecker) {
+	o.revocation = checker
+}
+
+// WithErrorHandler change how Auth writes failures, default is
+// DefaultErrorHandler.
+func (o *OIDC) WithErrorHandler(h ErrorHandler) {
+	o.errorHandler = h
+}
+
+// verify validates rawToken signature, issuer, audience and expiration.
+func (o *OIDC) verify(ctx context.Context, rawToken string) (*oidc.IDToken, error) {
+	//nolint:wrapcheck // oidc errors are returned to client as is.
+	return o.Verifier(&oidc.Config{
+		ClientID:             o.clientID,
+		Now:                  time.Now,
+		SupportedSigningAlgs: nil,
+		SkipClientIDCheck:    false,
+		SkipExpiryCheck:      false,
+		SkipIssuerCheck:      false,
+	}).Verify(ctx, rawToken)
+}
+
+// authenticator returns the claims of rawToken if it is valid.
+type authenticator func(ctx context.Context, rawToken string) (Claims, error)
+
+// idTokenClaims returns an authenticator using verify to validate tokens.
+func idTokenClaims(verify func(ctx context.Context, rawToken string) (*oidc.IDToken, error)) authenticator {
+	return func(ctx context.Context, rawToken string) (Claims, error) {
+		idToken, err := verify(ctx, rawToken)
+		if err != nil {
+			return nil, err
+		}
+
+		claims := Claims{}
+		if err := idToken.Claims(&claims); err != nil {
+			return nil, errors.Wrap(err, "cannot unmarshal claims")
+		}
+
+		return claims, nil
+	}
+}
+
+// authHandler validates authorization token using authenticate and populate
+// context with its claims.
+func authHandler(
+	logger log.Logger,
+	onError ErrorHandler,
+	authenticate authenticator,
+	next http.Handler,
+) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		rawAccessToken := r.Header.Get("Authorization")
 		if rawAccessToken == "" {
-			http.Error(w, "no authorization header", http.StatusBadRequest)
-			o.logger.Warn(r.Context(), "auth: empty authorization handler")
+			onError(w, r, unauthenticated(nil))
+			logger.Warn(r.Context(), "auth: empty authorization handler")
 
 			return
 		}
 
 		parts := strings.Split(rawAccessToken, " ")
-		if len(parts) != tokenParts {
-			w.WriteHeader(http.StatusBadRequest)
-			o.logger.Warn(r.Context(), "auth: unexpected  authorization size")
+		if len(parts) != tokenParts || !strings.EqualFold(parts[0], "Bearer") {
+			onError(w, r, &AuthError{
+				Status:      http.StatusBadRequest,
+				Code:        ErrorCodeInvalidRequest,
+				Description: "authorization header must be: Bearer <token>",
+				Scope:       "",
+				Err:         nil,
+			})
+			logger.Warn(r.Context(), "auth: unexpected  authorization size")
 
 			return
 		}
 
-		idToken, err := o.Verifier(&oidc.Config{
-			ClientID:             o.clientID,
-			Now:                  time.Now,
-			SupportedSigningAlgs: nil,
-			SkipClientIDCheck:    false,
-			SkipExpiryCheck:      false,
-			SkipIssuerCheck:      false,
-		}).Verify(r.Context(), parts[tokenPos])
-		if err != nil {
-			http.Error(w, "cannot validate token: "+err.Error(), http.StatusUnauthorized)
-			o.logger.Warn(r.Context(), "auth: invalid token", log.Any("token", parts[tokenPos]), log.Error(err))
+		claims, err := authenticate(r.Context(), parts[tokenPos])
+		var revocationErr *revocationError
+		if errors.As(err, &revocationErr) {
+			// store errors may expose internals, only the sentinel is given
+			// to onError.
+			onError(w, r, &AuthError{
+				Status:      http.StatusServiceUnavailable,
+				Code:        "",
+				Description: "token revocation cannot be checked, try again later",
+				Scope:       "",
+				Err:         ErrRevocationUnavailable,
+			})
+			logger.Error(r.Context(), "auth: cannot check token revocation", log.Error(revocationErr.err))
 
 			return
 		}
-
-		resp := Claims{}
-		if err := idToken.Claims(&resp); err != nil {
-			http.Error(w, "cannot unmarshal claims: "+err.Error(), http.StatusInternalServerError)
-			o.logger.Warn(r.Context(), "auth: cannot unmarshal claims", log.Error(err))
+		if err != nil {
+			onError(w, r, &AuthError{
+				Status:      http.StatusUnauthorized,
+				Code:        ErrorCodeInvalidToken,
+				Description: "token is invalid or expired",
+				Scope:       "",
+				Err:         err,
+			})
+			// tokens are credentials, they are never logged.
+			logger.Warn(r.Context(), "auth: invalid token", log.Error(err))
 
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), contextKey, resp)
+		ctx := context.WithValue(r.Context(), contextKey, claims)
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-// HasRole inspect ctx for role claim, if present returns true. Before using this
-// function ctx should be populated with the token claims, generally using
-// OIDC.Auth method.
+// HasRole inspect ctx for role claim at RolesClaimPath, if present returns
+// true. Before using this function ctx should be populated with the token
+// claims, generally using OIDC.Auth method.
 func HasRole(ctx context.Context, role string) bool {
-	r := ctx.Value(contextKey)
-	if r == nil {
-		return false
-	}
-
-	claims, ok := r.(Claims)
-	if !ok {
-		return false
-	}
-	access, ok := claims["realm_access"].(map[string]interface{})
-	if !ok {
-		return false
-	}
-	roles, ok := access["roles"].([]interface{})
-	if !ok {
-		return false
-	}
-
-	found := false
-	for _, r := range roles {
-		if role == r {
-			return true
-		}
-	}
-
-	return found
+	return HasRoleAt(ctx, RolesClaimPath, role)
 }
 
 // HasRoleMiddleware wrap HasRole inside an http middleware to prevent access to
 // handlers after. OIDC.Auth must be present before this middleware, otherwise
 // claims will not be present at http.Request.Context.
-func HasRoleMiddleware(role string) func(next http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if !HasRole(r.Context(), role) {
-				http.Error(w, "Invalid role", http.StatusUnauthorized)
-
-				return
-			}
-
-			next.ServeHTTP(w, r)
-		})
-	}
+func HasRoleMiddleware(role string, opts ...MiddlewareOption) func(next http.Handler) http.Handler {
+	return HasRoleAtMiddleware(RolesClaimPath, role, opts...)
 }
 
 // HasScope inspect ctx for scope claim, if present returns true. Before using this
 // function ctx should be populated with the token claims, generally using
 // OIDC.Auth method.
 func HasScope(ctx context.Context, scope string) bool {
-	s := ctx.Value(contextKey)
-	if s == nil {
-		return false
-	}
+	claims, ok := GetClaims(ctx)
 
-	claims, ok := s.(Claims)
-	if !ok {
-		return false
-	}
-	scopes, ok := claims["scope"].(string)
+	return ok && claims.HasScope(scope)
+}
+
+// HasScope returns true if scope is present at scope claim.
+func (c Claims) HasScope(scope string) bool {
+	scopes, ok := c["scope"].(string)
 	if !ok {
 		return false
 	}
 
-	found := false
-	for _, r := range strings.Split(scopes, " ") {
-		if scope == r {
-			found = true
-
-			break
+	for _, s := range strings.Split(scopes, " ") {
+		if scope == s {
+			return true
 		}
 	}
 
-	return found
+	return false
 }
 
 // HasScopeMiddleware wrap HasRole inside an http middleware to prevent access to
 // handlers after. OIDC.Auth must be present before this middleware, otherwise
 // claims will not be present at http.Request.Context.
-func HasScopeMiddleware(scope string) func(next http.Handler) http.Handler {
+func HasScopeMiddleware(scope string, opts ...MiddlewareOption) func(next http.Handler) http.Handler {
+	c := newMiddlewareConfig(opts)
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if !HasScope(r.Context(), scope) {
-				http.Error(w, "Invalid scope", http.StatusUnauthorized)
+			claims, ok := GetClaims(r.Context())
+			if !ok {
+				c.onError(w, r, unauthenticated(ErrNoClaims))
+
+				return
+			}
+			if !claims.HasScope(scope) {
+				c.onError(w, r, forbidden("missing scope", scope, nil))
 
 				return
 			}
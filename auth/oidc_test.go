@@ -88,7 +88,7 @@ func TestOIDCAuth(t *testing.T) {
 				clientID:     "wrong client id",
 				logger: func() log.Logger {
 					l := log.NewMockLogger(gomock.NewController(t))
-					l.EXPECT().Warn(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1)
+					l.EXPECT().Warn(gomock.Any(), gomock.Any(), gomock.Any()).Times(1)
 
 					return l
 				}(),
@@ -197,7 +197,7 @@ func TestHasRoleMiddleware(t *testing.T) {
 				return r.WithContext(context.WithValue(context.Background(), contextKey,
 					Claims{"realm_access": map[string]interface{}{"roles": []interface{}{"charge"}}}))
 			}(),
-			want: http.StatusUnauthorized,
+			want: http.StatusForbidden,
 		},
 		{
 			name: "stadard ctx",
@@ -303,7 +303,7 @@ func TestHasScopeMiddleware(t *testing.T) {
 				return r.WithContext(context.WithValue(context.Background(), contextKey,
 					Claims{"scope": "seller"}))
 			}(),
-			want: http.StatusUnauthorized,
+			want: http.StatusForbidden,
 		},
 		{
 			name: "stadard ctx",
@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/facily-tech/go-core/log"
+	"github.com/pkg/errors"
+)
+
+// Policy decides if a request, represented by its token claims, is authorized.
+// Compose them using AllOf, AnyOf and Not.
+type Policy interface {
+	// Evaluate returns nil if claims are authorized, otherwise a *DenyError.
+	Evaluate(ctx context.Context, claims Claims) error
+	// String describes policy, used at deny reasons.
+	String() string
+}
+
+// DenyError explains why a Policy denied access.
+type DenyError struct {
+	// Policy describes the policy which denied access.
+	Policy string
+	// Reason is why it was denied.
+	Reason string
+}
+
+// Error implements error.
+func (e *DenyError) Error() string {
+	return fmt.Sprintf("access denied by %s: %s", e.Policy, e.Reason)
+}
+
+type predicate struct {
+	name   string
+	reason string
+	fn     func(ctx context.Context, claims Claims) bool
+}
+
+func (p predicate) Evaluate(ctx context.Context, claims Claims) error {
+	if p.fn(ctx, claims) {
+		return nil
+	}
+
+	return &DenyError{Policy: p.name, Reason: p.reason}
+}
+
+func (p predicate) String() string {
+	return p.name
+}
+
+// Predicate creates a Policy from fn, name is used at deny reasons.
+func Predicate(name string, fn func(ctx context.Context, claims Claims) bool) Policy {
+	return predicate{name: name, reason: "predicate not satisfied", fn: fn}
+}
+
+// Role requires role at RolesClaimPath, see HasRole.
+func Role(role string) Policy {
+	return predicate{
+		name:   fmt.Sprintf("role(%q)", role),
+		reason: "missing role",
+		fn: func(_ context.Context, claims Claims) bool {
+			return claims.HasRoleAt(RolesClaimPath, role)
+		},
+	}
+}
+
+// RoleAt requires role at path, see HasRoleAt.
+func RoleAt(path RolesPath, role string) Policy {
+	return predicate{
+		name:   fmt.Sprintf("roleAt(%q, %q)", strings.Join(path, "."), role),
+		reason: "missing role",
+		fn: func(_ context.Context, claims Claims) bool {
+			return claims.HasRoleAt(path, role)
+		},
+	}
+}
+
+// ClientRole requires role of client, see HasClientRole.
+func ClientRole(client, role string) Policy {
+	return predicate{
+		name:   fmt.Sprintf("clientRole(%q, %q)", client, role),
+		reason: "missing client role",
+		fn: func(_ context.Context, claims Claims) bool {
+			return claims.HasRoleAt(KeycloakClientRolesPath(client), role)
+		},
+	}
+}
+
+// Scope requires scope, see HasScope.
+func Scope(scope string) Policy {
+	return predicate{
+		name:   fmt.Sprintf("scope(%q)", scope),
+		reason: "missing scope",
+		fn: func(_ context.Context, claims Claims) bool {
+			return claims.HasScope(scope)
+		},
+	}
+}
+
+// ClaimEquals requires root claim to be equal to value, compared by their json
+// representation, so 10 and 10.0 are equal.
+func ClaimEquals(claim string, value interface{}) Policy {
+	want, err := json.Marshal(value)
+
+	return predicate{
+		name:   fmt.Sprintf("claimEquals(%q, %s)", claim, want),
+		reason: "claim differs",
+		fn: func(_ context.Context, claims Claims) bool {
+			v, ok := claims[claim]
+			if !ok || err != nil {
+				return false
+			}
+			got, err := json.Marshal(v)
+
+			return err == nil && string(got) == string(want)
+		},
+	}
+}
+
+type allOf []Policy
+
+// AllOf requires every policy, it's denied by the first which denies.
+func AllOf(policies ...Policy) Policy {
+	return allOf(policies)
+}
+
+func (a allOf) Evaluate(ctx context.Context, claims Claims) error {
+	for _, p := range a {
+		if err := p.Evaluate(ctx, claims); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a allOf) String() string {
+	return "allOf(" + join(a) + ")"
+}
+
+type anyOf []Policy
+
+// AnyOf requires at least one policy, an empty AnyOf always denies.
+func AnyOf(policies ...Policy) Policy {
+	return anyOf(policies)
+}
+
+func (a anyOf) Evaluate(ctx context.Context, claims Claims) error {
+	reasons := make([]string, 0, len(a))
+	for _, p := range a {
+		err := p.Evaluate(ctx, claims)
+		if err == nil {
+			return nil
+		}
+		reasons = append(reasons, err.Error())
+	}
+
+	return &DenyError{Policy: a.String(), Reason: "none allowed: " + strings.Join(reasons, "; ")}
+}
+
+func (a anyOf) String() string {
+	return "anyOf(" + join(a) + ")"
+}
+
+type not struct {
+	Policy
+}
+
+// Not requires policy to deny.
+func Not(policy Policy) Policy {
+	return not{policy}
+}
+
+func (n not) Evaluate(ctx context.Context, claims Claims) error {
+	if n.Policy.Evaluate(ctx, claims) != nil {
+		return nil
+	}
+
+	return &DenyError{Policy: n.String(), Reason: n.Policy.String() + " allowed"}
+}
+
+func (n not) String() string {
+	return "not(" + n.Policy.String() + ")"
+}
+
+func join(policies []Policy) string {
+	names := make([]string, 0, len(policies))
+	for _, p := range policies {
+		names = append(names, p.String())
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// Authorize evaluates policy using claims from ctx. ctx should be populated
+// before calling Authorize with the token claims, generally using OIDC.Auth
+// method.
+func Authorize(ctx context.Context, policy Policy) error {
+	claims, ok := GetClaims(ctx)
+	if !ok {
+		return errors.WithStack(ErrNoClaims)
+	}
+
+	return policy.Evaluate(ctx, claims)
+}
+
+// Require wrap Authorize inside an http middleware to prevent access to
+// handlers after, denials are logged with policy and reason. OIDC.Auth must be
+// present before this middleware, otherwise claims will not be present at
+// http.Request.Context.
+func Require(logger log.Logger, policy Policy, opts ...MiddlewareOption) func(next http.Handler) http.Handler {
+	c := newMiddlewareConfig(opts)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			err := Authorize(r.Context(), policy)
+			if err == nil {
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			var deny *DenyError
+			if errors.As(err, &deny) {
+				logger.Warn(r.Context(), "auth: access denied",
+					log.Any("policy", deny.Policy), log.Any("reason", deny.Reason))
+			} else {
+				logger.Warn(r.Context(), "auth: access denied", log.Error(err))
+			}
+			c.onError(w, r, authorizationError(err))
+		})
+	}
+}
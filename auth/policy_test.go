@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/facily-tech/go-core/log"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy_Evaluate(t *testing.T) {
+	claims := Claims{
+		"realm_access": map[string]interface{}{"roles": []interface{}{"view"}},
+		"resource_access": map[string]interface{}{
+			"sellers-backend": map[string]interface{}{"roles": []interface{}{"refund"}},
+		},
+		"scope":    "openid seller",
+		"clientId": "sellers-backend",
+		"level":    float64(3),
+	}
+
+	tests := []struct {
+		name       string
+		policy     Policy
+		wantPolicy string
+	}{
+		{name: "role", policy: Role("view")},
+		{name: "missing role", policy: Role("charge"), wantPolicy: `role("charge")`},
+		{name: "role at", policy: RoleAt(KeycloakRealmRolesPath, "view")},
+		{name: "client role", policy: ClientRole("sellers-backend", "refund")},
+		{name: "missing client role", policy: ClientRole("other", "refund"), wantPolicy: `clientRole("other", "refund")`},
+		{name: "scope", policy: Scope("seller")},
+		{name: "claim equals", policy: ClaimEquals("clientId", "sellers-backend")},
+		{name: "claim equals number", policy: ClaimEquals("level", 3)},
+		{name: "claim differs", policy: ClaimEquals("clientId", "other"), wantPolicy: `claimEquals("clientId", "other")`},
+		{name: "claim absent", policy: ClaimEquals("absent", nil), wantPolicy: `claimEquals("absent", null)`},
+		{
+			name: "predicate",
+			policy: Predicate("level above 2", func(_ context.Context, c Claims) bool {
+				level, _ := c["level"].(float64)
+
+				return level > 2
+			}),
+		},
+		{name: "all of", policy: AllOf(Role("view"), Scope("seller"))},
+		{name: "all of denied by first", policy: AllOf(Role("view"), Scope("admin"), Role("x")), wantPolicy: `scope("admin")`},
+		{name: "any of", policy: AnyOf(Role("charge"), Scope("seller"))},
+		{
+			name:       "any of none",
+			policy:     AnyOf(Role("charge"), Scope("admin")),
+			wantPolicy: `anyOf(role("charge"), scope("admin"))`,
+		},
+		{name: "empty any of", policy: AnyOf(), wantPolicy: "anyOf()"},
+		{name: "not", policy: Not(Role("charge"))},
+		{name: "not denied", policy: Not(Role("view")), wantPolicy: `not(role("view"))`},
+		{
+			name:   "nested",
+			policy: AllOf(AnyOf(Role("admin"), ClientRole("sellers-backend", "refund")), Not(Scope("guest"))),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Evaluate(context.Background(), claims)
+			if tt.wantPolicy == "" {
+				assert.NoError(t, err)
+
+				return
+			}
+
+			var deny *DenyError
+			assert.ErrorAs(t, err, &deny)
+			assert.Equal(t, tt.wantPolicy, deny.Policy)
+			assert.NotEmpty(t, deny.Reason)
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	assert.ErrorIs(t, Authorize(context.Background(), Role("view")), ErrNoClaims)
+
+	ctx := context.WithValue(context.Background(), contextKey, Claims{"scope": "seller"})
+	assert.NoError(t, Authorize(ctx, Scope("seller")))
+}
+
+func TestRequire(t *testing.T) {
+	claims := Claims{"realm_access": map[string]interface{}{"roles": []interface{}{"view"}}}
+
+	tests := []struct {
+		name   string
+		ctx    context.Context //nolint:containedctx
+		policy Policy
+		want   int
+	}{
+		{
+			name:   "allowed",
+			ctx:    context.WithValue(context.Background(), contextKey, claims),
+			policy: Role("view"),
+			want:   http.StatusOK,
+		},
+		{
+			name:   "denied",
+			ctx:    context.WithValue(context.Background(), contextKey, claims),
+			policy: AllOf(Role("view"), Role("charge")),
+			want:   http.StatusForbidden,
+		},
+		{
+			name:   "no claims",
+			ctx:    context.Background(),
+			policy: Role("view"),
+			want:   http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := log.NewMockLogger(gomock.NewController(t))
+			if tt.want != http.StatusOK {
+				logger.EXPECT().Warn(gomock.Any(), "auth: access denied", gomock.Any()).Times(1)
+			}
+			r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(tt.ctx)
+			w := httptest.NewRecorder()
+
+			Require(logger, tt.policy)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+}
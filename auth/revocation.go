@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const revocationPrefix = "auth:revoked:"
+
+var (
+	// ErrRevokedToken error when token was revoked before its expiration.
+	ErrRevokedToken = errors.New("token revoked")
+	// ErrNoRevocationID error when token has neither jti nor sid to be revoked.
+	ErrNoRevocationID = errors.New("token has neither jti nor sid")
+	// ErrRevocationUnavailable error when RevocationChecker fails, like its
+	// store being down. Middlewares respond 503 and log the cause.
+	ErrRevocationUnavailable = errors.New("token revocation cannot be checked")
+)
+
+// RevocationChecker tells if a verified token was revoked, by its jti, sid or
+// subject. It only uses standard types, so the same implementation, like
+// Denylist, may be used by http/server/middleware.JWTConfig.
+type RevocationChecker interface {
+	// Revoked returns true if token is revoked, empty arguments are unknown.
+	Revoked(ctx context.Context, jti, sid, sub string, issuedAt time.Time) (bool, error)
+}
+
+// DenylistStore persists revocations, cache.ClientI satisfies it.
+type DenylistStore interface {
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	Get(ctx context.Context, key string) (string, error)
+}
+
+// Denylist is a RevocationChecker storing revoked jti, sid and subjects at a
+// DenylistStore. A revoked jti or sid rejects every token having it, while a
+// revoked subject rejects its tokens issued until revocation, so new logins
+// are allowed.
+type Denylist struct {
+	store   DenylistStore
+	missErr error
+}
+
+var _ RevocationChecker = (*Denylist)(nil)
+
+// NewDenylist returns a Denylist using store, missErr is the error returned by
+// store when key does not exist, like cache.ErrKeyMiss, or nil if store
+// returns an empty value without error. To share it between replicas use
+// redis:
+//
+//	denylist := auth.NewDenylist(cacheClient, cache.ErrKeyMiss)
+func NewDenylist(store DenylistStore, missErr error) *Denylist {
+	return &Denylist{store: store, missErr: missErr}
+}
+
+// NewMemoryDenylist returns a Denylist kept in memory, useful for tests and
+// single replica services.
+func NewMemoryDenylist() *Denylist {
+	return NewDenylist(newMemoryCache(), errCacheMiss)
+}
+
+// RevokeTokenID revokes jti for ttl, generally until token expiration.
+func (d *Denylist) RevokeTokenID(ctx context.Context, jti string, ttl time.Duration) error {
+	return d.revoke(ctx, ClaimTokenID, jti, ttl)
+}
+
+// RevokeSession revokes every token of session sid for ttl.
+func (d *Denylist) RevokeSession(ctx context.Context, sid string, ttl time.Duration) error {
+	return d.revoke(ctx, ClaimSessionID, sid, ttl)
+}
+
+// RevokeSubject revokes every token of sub issued until now, ttl should be
+// the longest token lifetime.
+func (d *Denylist) RevokeSubject(ctx context.Context, sub string, ttl time.Duration) error {
+	return d.revoke(ctx, ClaimSubject, sub, ttl)
+}
+
+// RevokeClaims revokes token by its jti, or by sid if it has no jti, until its
+// expiration.
+func (d *Denylist) RevokeClaims(ctx context.Context, claims Claims) error {
+	ttl := time.Until(claims.ExpiresAt())
+	if ttl <= 0 {
+		return nil
+	}
+
+	if jti := claims.String(ClaimTokenID); jti != "" {
+		return d.RevokeTokenID(ctx, jti, ttl)
+	}
+	if sid := claims.String(ClaimSessionID); sid != "" {
+		return d.RevokeSession(ctx, sid, ttl)
+	}
+
+	return errors.WithStack(ErrNoRevocationID)
+}
+
+func (d *Denylist) revoke(ctx context.Context, claim, value string, ttl time.Duration) error {
+	if value == "" {
+		return errors.Errorf("cannot revoke empty %s", claim)
+	}
+
+	revokedAt := strconv.FormatInt(time.Now().Unix(), 10)
+
+	return errors.Wrap(d.store.Set(ctx, revocationKey(claim, value), revokedAt, ttl), "cannot revoke")
+}
+
+// Revoked implements RevocationChecker.
+func (d *Denylist) Revoked(ctx context.Context, jti, sid, sub string, issuedAt time.Time) (bool, error) {
+	for _, id := range []struct{ claim, value string }{
+		{ClaimTokenID, jti},
+		{ClaimSessionID, sid},
+		{ClaimSubject, sub},
+	} {
+		if id.value == "" {
+			continue
+		}
+
+		raw, err := d.store.Get(ctx, revocationKey(id.claim, id.value))
+		if err != nil {
+			if d.missErr != nil && errors.Is(err, d.missErr) {
+				continue
+			}
+
+			return false, errors.Wrap(err, "cannot check revocation")
+		}
+		// stores returning no error on miss, with a nil missErr, return "".
+		if raw == "" {
+			continue
+		}
+
+		if id.claim != ClaimSubject {
+			return true, nil
+		}
+
+		revokedAt, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || issuedAt.IsZero() || issuedAt.Unix() <= revokedAt {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func revocationKey(claim, value string) string {
+	return revocationPrefix + claim + ":" + value
+}
+
+// checkRevocation returns an authenticator rejecting tokens revoked at
+// checker, after authenticate verifies them.
+func checkRevocation(authenticate authenticator, checker RevocationChecker) authenticator {
+	if checker == nil {
+		return authenticate
+	}
+
+	return func(ctx context.Context, rawToken string) (Claims, error) {
+		claims, err := authenticate(ctx, rawToken)
+		if err != nil {
+			return nil, err
+		}
+
+		revoked, err := checker.Revoked(ctx,
+			claims.String(ClaimTokenID),
+			claims.String(ClaimSessionID),
+			claims.Subject(),
+			claims.IssuedAt(),
+		)
+		if err != nil {
+			return nil, &revocationError{err: err}
+		}
+		if revoked {
+			return nil, errors.WithStack(ErrRevokedToken)
+		}
+
+		return claims, nil
+	}
+}
+
+// revocationError is a RevocationChecker failure, it's not the token fault, so
+// it's answered with 503 and the cause is only logged.
+type revocationError struct {
+	err error
+}
+
+func (e *revocationError) Error() string {
+	return ErrRevocationUnavailable.Error() + ": " + e.err.Error()
+}
+
+func (e *revocationError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,257 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/facily-tech/go-core/log"
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDenylist_Revoked(t *testing.T) {
+	ctx := context.Background()
+	d := NewMemoryDenylist()
+
+	require.NoError(t, d.RevokeTokenID(ctx, "jti-1", time.Minute))
+	require.NoError(t, d.RevokeSession(ctx, "sid-1", time.Minute))
+	require.NoError(t, d.RevokeSubject(ctx, "sub-1", time.Minute))
+	require.NoError(t, d.RevokeTokenID(ctx, "jti-expired", -time.Second))
+
+	before := time.Now().Add(-time.Minute)
+	after := time.Now().Add(time.Minute)
+
+	tests := []struct {
+		name     string
+		jti      string
+		sid      string
+		sub      string
+		issuedAt time.Time
+		want     bool
+	}{
+		{name: "not revoked", jti: "jti-2", sid: "sid-2", sub: "sub-2", issuedAt: before},
+		{name: "revoked jti", jti: "jti-1", sid: "sid-2", sub: "sub-2", issuedAt: before, want: true},
+		{name: "revoked session", jti: "jti-2", sid: "sid-1", sub: "sub-2", issuedAt: before, want: true},
+		{name: "revoked subject", jti: "jti-2", sub: "sub-1", issuedAt: before, want: true},
+		{name: "revoked subject without iat", sub: "sub-1", want: true},
+		{name: "subject logged in again", jti: "jti-2", sub: "sub-1", issuedAt: after},
+		{name: "revocation expired", jti: "jti-expired", issuedAt: before},
+		{name: "no ids"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.Revoked(ctx, tt.jti, tt.sid, tt.sub, tt.issuedAt)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Set(context.Context, string, string, time.Duration) error {
+	return errors.New("connection refused")
+}
+
+func (failingStore) Get(context.Context, string) (string, error) {
+	return "", errors.New("connection refused")
+}
+
+// emptyOnMissStore returns "" without error for missing keys.
+type emptyOnMissStore struct {
+	*memoryCache
+}
+
+func (s emptyOnMissStore) Get(ctx context.Context, key string) (string, error) {
+	value, err := s.memoryCache.Get(ctx, key)
+	if errors.Is(err, errCacheMiss) {
+		return "", nil
+	}
+
+	return value, err
+}
+
+func TestDenylist_nilMissErr(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("store failing on miss", func(t *testing.T) {
+		d := NewDenylist(newMemoryCache(), nil)
+		require.NoError(t, d.RevokeTokenID(ctx, "j", time.Minute))
+
+		revoked, err := d.Revoked(ctx, "j", "", "", time.Time{})
+		assert.NoError(t, err)
+		assert.True(t, revoked)
+
+		// misses are store errors, so tokens are not accepted unchecked.
+		_, err = d.Revoked(ctx, "other", "", "", time.Time{})
+		assert.Error(t, err)
+	})
+	t.Run("store empty on miss", func(t *testing.T) {
+		d := NewDenylist(emptyOnMissStore{newMemoryCache()}, nil)
+		require.NoError(t, d.RevokeTokenID(ctx, "j", time.Minute))
+
+		revoked, err := d.Revoked(ctx, "j", "", "", time.Time{})
+		assert.NoError(t, err)
+		assert.True(t, revoked)
+
+		revoked, err = d.Revoked(ctx, "other", "", "", time.Time{})
+		assert.NoError(t, err)
+		assert.False(t, revoked)
+	})
+}
+
+func TestDenylist_storeErrors(t *testing.T) {
+	d := NewDenylist(failingStore{}, errCacheMiss)
+
+	assert.Error(t, d.RevokeTokenID(context.Background(), "jti-1", time.Minute))
+
+	_, err := d.Revoked(context.Background(), "jti-1", "", "", time.Time{})
+	assert.Error(t, err)
+}
+
+// cacheClient mirrors cache.ClientI, which auth does not import, so any
+// cache client is checked to be a DenylistStore.
+type cacheClient interface {
+	Set(context.Context, string, string, time.Duration) error
+	Get(context.Context, string) (string, error)
+	Del(context.Context, ...string) error
+}
+
+var _ DenylistStore = (cacheClient)(nil)
+
+// redisClient behaves like cache.Client, wrapping its miss error with the key.
+type redisClient struct {
+	*memoryCache
+}
+
+func (c redisClient) Get(ctx context.Context, key string) (string, error) {
+	value, err := c.memoryCache.Get(ctx, key)
+	if errors.Is(err, errCacheMiss) {
+		return "", errors.Wrapf(err, "miss trying to get key '%s'", key)
+	}
+
+	return value, err
+}
+
+func (c redisClient) Del(context.Context, ...string) error {
+	return nil
+}
+
+func TestNewDenylist_cacheClient(t *testing.T) {
+	ctx := context.Background()
+	var client cacheClient = redisClient{memoryCache: newMemoryCache()}
+	d := NewDenylist(client, errCacheMiss)
+
+	require.NoError(t, d.RevokeTokenID(ctx, "jti-1", time.Minute))
+
+	revoked, err := d.Revoked(ctx, "jti-1", "", "", time.Time{})
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	revoked, err = d.Revoked(ctx, "jti-2", "", "", time.Time{})
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+}
+
+func TestOIDC_WithRevocation_storeErrors(t *testing.T) {
+	key := newTestKey(t, "a")
+	issuer := "http://localhost:8080/realms/finance"
+
+	logger := log.NewMockLogger(gomock.NewController(t))
+	logger.EXPECT().Error(gomock.Any(), "auth: cannot check token revocation", gomock.Any()).Times(1)
+
+	o, err := NewOffline(context.Background(), logger, OfflineConfig{
+		ClientID: "client",
+		Issuer:   issuer,
+		KeySet:   KeySetConfig{JWKS: key.jwks(t), RefreshInterval: -1},
+	})
+	require.NoError(t, err)
+
+	var got *AuthError
+	o.WithRevocation(NewDenylist(failingStore{}, errCacheMiss))
+	o.WithErrorHandler(func(w http.ResponseWriter, r *http.Request, err *AuthError) {
+		got = err
+		WriteError(w, r, err)
+	})
+
+	token := key.sign(t, Claims{"iss": issuer, "aud": "client", "sub": "123", "exp": time.Now().Add(time.Minute).Unix()})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Add("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+
+	o.Auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.NotContains(t, w.Body.String(), "connection refused")
+	require.NotNil(t, got)
+	assert.Equal(t, ErrRevocationUnavailable, got.Err)
+}
+
+func TestDenylist_RevokeClaims(t *testing.T) {
+	ctx := context.Background()
+	d := NewMemoryDenylist()
+	exp := time.Now().Add(time.Hour).Unix()
+
+	require.NoError(t, d.RevokeClaims(ctx, Claims{ClaimTokenID: "jti-1", ClaimExpiresAt: exp}))
+	require.NoError(t, d.RevokeClaims(ctx, Claims{ClaimSessionID: "sid-1", ClaimExpiresAt: exp}))
+	assert.ErrorIs(t, d.RevokeClaims(ctx, Claims{ClaimExpiresAt: exp}), ErrNoRevocationID)
+
+	revoked, err := d.Revoked(ctx, "jti-1", "", "", time.Time{})
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	revoked, err = d.Revoked(ctx, "", "sid-1", "", time.Time{})
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+}
+
+func TestOIDC_WithRevocation(t *testing.T) {
+	key := newTestKey(t, "a")
+	issuer := "http://localhost:8080/realms/finance"
+
+	logger := log.NewMockLogger(gomock.NewController(t))
+	logger.EXPECT().Warn(gomock.Any(), "auth: invalid token", gomock.Any()).Times(1)
+
+	o, err := NewOffline(context.Background(), logger, OfflineConfig{
+		ClientID: "client",
+		Issuer:   issuer,
+		KeySet:   KeySetConfig{JWKS: key.jwks(t), RefreshInterval: -1},
+	})
+	require.NoError(t, err)
+
+	denylist := NewMemoryDenylist()
+	require.NoError(t, denylist.RevokeSession(context.Background(), "logged-out", time.Minute))
+	o.WithRevocation(denylist)
+
+	tests := []struct {
+		name string
+		sid  string
+		want int
+	}{
+		{name: "active session", sid: "active", want: http.StatusOK},
+		{name: "revoked session", sid: "logged-out", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := key.sign(t, Claims{
+				"iss": issuer,
+				"aud": "client",
+				"sub": "123",
+				"sid": tt.sid,
+				"exp": time.Now().Add(time.Minute).Unix(),
+			})
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Add("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+
+			o.Auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// RolesPath is the path, one claim name per level, of a roles list inside
+// claims. Names are not split, so namespaced claims like Auth0
+// "https://facily.com.br/roles" are a single level.
+type RolesPath []string
+
+var (
+	// KeycloakRealmRolesPath is where keycloak put realm roles.
+	KeycloakRealmRolesPath = RolesPath{"realm_access", "roles"}
+	// CognitoGroupsPath is where cognito put user groups.
+	CognitoGroupsPath = RolesPath{"cognito:groups"}
+
+	// RolesClaimPath is used by HasRole and HasRoleMiddleware, change it at
+	// startup to use another provider.
+	RolesClaimPath = KeycloakRealmRolesPath
+)
+
+// KeycloakClientRolesPath is where keycloak put roles of client.
+func KeycloakClientRolesPath(client string) RolesPath {
+	return RolesPath{"resource_access", client, "roles"}
+}
+
+// HasRoleAt inspect ctx for role at claims path, if present returns true.
+// Roles may be a list or a space separated string. Before using this function
+// ctx should be populated with the token claims, generally using OIDC.Auth
+// method.
+func HasRoleAt(ctx context.Context, path RolesPath, role string) bool {
+	claims, ok := GetClaims(ctx)
+
+	return ok && claims.HasRoleAt(path, role)
+}
+
+// HasRoleAt returns true if role is present at claims path. Roles may be a
+// list or a space separated string.
+func (c Claims) HasRoleAt(path RolesPath, role string) bool {
+	if len(path) == 0 {
+		return false
+	}
+
+	var value interface{} = map[string]interface{}(c)
+	for _, name := range path {
+		level, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		value = level[name]
+	}
+
+	switch roles := value.(type) {
+	case []interface{}:
+		for _, r := range roles {
+			if role == r {
+				return true
+			}
+		}
+	case []string:
+		for _, r := range roles {
+			if role == r {
+				return true
+			}
+		}
+	case string:
+		for _, r := range strings.Fields(roles) {
+			if role == r {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// HasRoleAtMiddleware wrap HasRoleAt inside an http middleware to prevent
+// access to handlers after. OIDC.Auth must be present before this middleware,
+// otherwise claims will not be present at http.Request.Context.
+func HasRoleAtMiddleware(path RolesPath, role string, opts ...MiddlewareOption) func(next http.Handler) http.Handler {
+	c := newMiddlewareConfig(opts)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := GetClaims(r.Context())
+			if !ok {
+				c.onError(w, r, unauthenticated(ErrNoClaims))
+
+				return
+			}
+			if !claims.HasRoleAt(path, role) {
+				c.onError(w, r, forbidden("missing role", "", nil))
+
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// HasClientRole inspect ctx for role of client at resource_access claim, if
+// present returns true. Before using this function ctx should be populated
+// with the token claims, generally using OIDC.Auth method.
+func HasClientRole(ctx context.Context, client, role string) bool {
+	return HasRoleAt(ctx, KeycloakClientRolesPath(client), role)
+}
+
+// HasClientRoleMiddleware wrap HasClientRole inside an http middleware to
+// prevent access to handlers after. OIDC.Auth must be present before this
+// middleware, otherwise claims will not be present at http.Request.Context.
+func HasClientRoleMiddleware(client, role string, opts ...MiddlewareOption) func(next http.Handler) http.Handler {
+	return HasRoleAtMiddleware(KeycloakClientRolesPath(client), role, opts...)
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHasRoleAt(t *testing.T) {
+	claims := Claims{
+		"realm_access": map[string]interface{}{"roles": []interface{}{"view"}},
+		"resource_access": map[string]interface{}{
+			"sellers-backend": map[string]interface{}{"roles": []interface{}{"uma_protection"}},
+		},
+		"https://facily.com.br/roles": []string{"admin"},
+		"cognito:groups":              []interface{}{"partners"},
+		"groups":                      "staff finance",
+	}
+	ctx := context.WithValue(context.Background(), contextKey, claims)
+
+	tests := []struct {
+		name string
+		ctx  context.Context //nolint:containedctx
+		path RolesPath
+		role string
+		want bool
+	}{
+		{name: "realm role", ctx: ctx, path: KeycloakRealmRolesPath, role: "view", want: true},
+		{name: "client role", ctx: ctx, path: KeycloakClientRolesPath("sellers-backend"), role: "uma_protection", want: true},
+		{name: "client role of other client", ctx: ctx, path: KeycloakClientRolesPath("other"), role: "uma_protection"},
+		{name: "namespaced claim", ctx: ctx, path: RolesPath{"https://facily.com.br/roles"}, role: "admin", want: true},
+		{name: "cognito groups", ctx: ctx, path: CognitoGroupsPath, role: "partners", want: true},
+		{name: "space separated", ctx: ctx, path: RolesPath{"groups"}, role: "finance", want: true},
+		{name: "role not found", ctx: ctx, path: KeycloakRealmRolesPath, role: "charge"},
+		{name: "path is not an object", ctx: ctx, path: RolesPath{"groups", "roles"}, role: "staff"},
+		{name: "empty path", ctx: ctx, path: nil, role: "view"},
+		{name: "no claims", ctx: context.Background(), path: KeycloakRealmRolesPath, role: "view"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, HasRoleAt(tt.ctx, tt.path, tt.role))
+		})
+	}
+}
+
+func TestHasRole_rolesClaimPath(t *testing.T) {
+	defer func(path RolesPath) { RolesClaimPath = path }(RolesClaimPath)
+	RolesClaimPath = CognitoGroupsPath
+
+	ctx := context.WithValue(context.Background(), contextKey, Claims{"cognito:groups": []interface{}{"partners"}})
+	assert.True(t, HasRole(ctx, "partners"))
+}
+
+func TestHasClientRoleMiddleware(t *testing.T) {
+	claims := Claims{
+		"resource_access": map[string]interface{}{
+			"sellers-backend": map[string]interface{}{"roles": []interface{}{"uma_protection"}},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		client string
+		role   string
+		want   int
+	}{
+		{name: "client role found", client: "sellers-backend", role: "uma_protection", want: http.StatusOK},
+		{name: "client role NOT found", client: "sellers-backend", role: "charge", want: http.StatusForbidden},
+		{name: "client NOT found", client: "other", role: "uma_protection", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r = r.WithContext(context.WithValue(context.Background(), contextKey, claims))
+			w := httptest.NewRecorder()
+
+			HasClientRoleMiddleware(tt.client, tt.role)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+
+			assert.Equal(t, tt.want, w.Code)
+			assert.Equal(t, tt.want == http.StatusOK, HasClientRole(r.Context(), tt.client, tt.role))
+		})
+	}
+}
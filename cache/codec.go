@@ -0,0 +1,223 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrNotProtoMessage is the error returned by Protobuf codec when value is not
+// a proto.Message.
+var ErrNotProtoMessage = errors.New("value is not a proto.Message")
+
+// gzipMagic starts every gzip stream, json, msgpack and protobuf values never
+// start with it, so compressed values are detected on read.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Codec encodes values stored at cache.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// Codecs ready to use with WithCodec.
+var (
+	JSON     Codec = jsonCodec{}
+	Msgpack  Codec = msgpackCodec{}
+	Protobuf Codec = protobufCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	b, err := json.Marshal(v)
+
+	return b, errors.Wrap(err, "cannot marshal json")
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return errors.Wrap(json.Unmarshal(data, v), "cannot unmarshal json")
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Marshal(v any) ([]byte, error) {
+	b, err := msgpack.Marshal(v)
+
+	return b, errors.Wrap(err, "cannot marshal msgpack")
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v any) error {
+	return errors.Wrap(msgpack.Unmarshal(data, v), "cannot unmarshal msgpack")
+}
+
+// protobufCodec requires values to be a proto.Message, so Set and Get type
+// parameter must be a pointer to a generated message.
+type protobufCodec struct{}
+
+func (protobufCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, errors.WithStack(ErrNotProtoMessage)
+	}
+	b, err := proto.Marshal(m)
+
+	return b, errors.Wrap(err, "cannot marshal protobuf")
+}
+
+func (protobufCodec) Unmarshal(data []byte, v any) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		// Get passes a pointer to T, where T is a pointer to message, so a new
+		// message is allocated.
+		ptr := reflect.ValueOf(v)
+		if ptr.Kind() != reflect.Pointer || ptr.Elem().Kind() != reflect.Pointer {
+			return errors.WithStack(ErrNotProtoMessage)
+		}
+		msg := reflect.New(ptr.Elem().Type().Elem())
+		if m, ok = msg.Interface().(proto.Message); !ok {
+			return errors.WithStack(ErrNotProtoMessage)
+		}
+		ptr.Elem().Set(msg)
+	}
+
+	return errors.Wrap(proto.Unmarshal(data, m), "cannot unmarshal protobuf")
+}
+
+type options struct {
+	codec            Codec
+	compressMinBytes int
+	locker           Locker
+	lockTTL          time.Duration
+	loadTimeout      time.Duration
+	beta             float64
+}
+
+// Option configures Set, Get and GetOrLoad.
+type Option func(*options)
+
+// WithCodec changes how values are encoded, default JSON. Get must use the
+// same codec used by Set.
+func WithCodec(codec Codec) Option {
+	return func(o *options) {
+		o.codec = codec
+	}
+}
+
+// WithCompression gzip encoded values with at least minBytes. Get detects
+// compressed values by itself, so it is only needed by Set.
+func WithCompression(minBytes int) Option {
+	return func(o *options) {
+		o.compressMinBytes = minBytes
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{codec: JSON, compressMinBytes: -1, loadTimeout: defaultLoadTimeout, beta: 1}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+// Set encodes value, using JSON unless WithCodec is given, and stores it at
+// key using c.
+func Set[T any](ctx context.Context, c ClientI, key string, value T, expire time.Duration, opts ...Option) error {
+	data, err := encode(key, value, newOptions(opts))
+	if err != nil {
+		return err
+	}
+
+	return c.Set(ctx, key, string(data), expire)
+}
+
+// Get retrieves key using c and decodes it into a T, using JSON unless
+// WithCodec is given. A missing key returns ErrKeyMiss from c.
+func Get[T any](ctx context.Context, c ClientI, key string, opts ...Option) (T, error) {
+	value, _, err := get[T](ctx, c, key, newOptions(opts))
+
+	return value, err
+}
+
+// SetJSON is Set using JSON codec.
+func SetJSON[T any](ctx context.Context, c ClientI, key string, value T, expire time.Duration, opts ...Option) error {
+	return Set(ctx, c, key, value, expire, append(opts[:len(opts):len(opts)], WithCodec(JSON))...)
+}
+
+// GetJSON is Get using JSON codec.
+func GetJSON[T any](ctx context.Context, c ClientI, key string, opts ...Option) (T, error) {
+	return Get[T](ctx, c, key, append(opts[:len(opts):len(opts)], WithCodec(JSON))...)
+}
+
+func encode[T any](key string, value T, o options) ([]byte, error) {
+	data, err := o.codec.Marshal(value)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot encode key '%s'", key)
+	}
+
+	if o.compressMinBytes >= 0 && len(data) >= o.compressMinBytes {
+		if data, err = compress(data); err != nil {
+			return nil, errors.Wrapf(err, "cannot compress key '%s'", key)
+		}
+	}
+
+	return data, nil
+}
+
+// get retrieves and decodes key, with load metadata when stored by GetOrLoad.
+func get[T any](ctx context.Context, c ClientI, key string, o options) (T, loadMeta, error) {
+	var value T
+
+	raw, err := c.Get(ctx, key)
+	if err != nil {
+		return value, loadMeta{}, err
+	}
+
+	meta, data := splitLoadMeta([]byte(raw))
+	if bytes.HasPrefix(data, gzipMagic) {
+		if data, err = decompress(data); err != nil {
+			return value, meta, errors.Wrapf(err, "cannot decompress key '%s'", key)
+		}
+	}
+
+	if err := o.codec.Unmarshal(data, &value); err != nil {
+		return value, meta, errors.Wrapf(err, "cannot decode key '%s'", key)
+	}
+
+	return value, meta, nil
+}
+
+func compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer r.Close()
+
+	out, err := io.ReadAll(r)
+
+	return out, errors.WithStack(err)
+}
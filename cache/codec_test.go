@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// mapClient is an in-memory ClientI.
+type mapClient map[string]string
+
+func (m mapClient) Set(_ context.Context, key, value string, _ time.Duration) error {
+	m[key] = value
+
+	return nil
+}
+
+func (m mapClient) Get(_ context.Context, key string) (string, error) {
+	v, ok := m[key]
+	if !ok {
+		return "", ErrKeyMiss
+	}
+
+	return v, nil
+}
+
+func (m mapClient) Del(_ context.Context, keys ...string) error {
+	for _, k := range keys {
+		delete(m, k)
+	}
+
+	return nil
+}
+
+type order struct {
+	ID    int      `json:"id"    msgpack:"id"`
+	Items []string `json:"items" msgpack:"items"`
+}
+
+func TestSetGet(t *testing.T) {
+	ctx := context.Background()
+	value := order{ID: 7, Items: []string{strings.Repeat("sku", 100)}}
+
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "json", opts: nil},
+		{name: "msgpack", opts: []Option{WithCodec(Msgpack)}},
+		{name: "json compressed", opts: []Option{WithCompression(64)}},
+		{name: "msgpack compressed", opts: []Option{WithCodec(Msgpack), WithCompression(0)}},
+		{name: "below compression threshold", opts: []Option{WithCompression(1 << 20)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mapClient{}
+
+			require.NoError(t, Set(ctx, c, "order", value, time.Minute, tt.opts...))
+			got, err := Get[order](ctx, c, "order", tt.opts...)
+
+			assert.NoError(t, err)
+			assert.Equal(t, value, got)
+		})
+	}
+}
+
+func TestSetJSON(t *testing.T) {
+	ctx := context.Background()
+	c := mapClient{}
+
+	require.NoError(t, SetJSON(ctx, c, "order", order{ID: 7}, time.Minute))
+	assert.JSONEq(t, `{"id": 7, "items": null}`, c["order"], "uncompressed values are plain json")
+
+	got, err := GetJSON[order](ctx, c, "order")
+	assert.NoError(t, err)
+	assert.Equal(t, order{ID: 7}, got)
+
+	require.NoError(t, SetJSON(ctx, c, "big", order{ID: 8, Items: []string{strings.Repeat("sku", 100)}}, time.Minute, WithCompression(64)))
+	assert.Less(t, len(c["big"]), 100)
+	got, err = GetJSON[order](ctx, c, "big")
+	assert.NoError(t, err)
+	assert.Equal(t, 8, got.ID)
+}
+
+func TestSetGet_protobuf(t *testing.T) {
+	ctx := context.Background()
+	c := mapClient{}
+
+	require.NoError(t, Set(ctx, c, "name", wrapperspb.String("facily"), time.Minute, WithCodec(Protobuf)))
+	got, err := Get[*wrapperspb.StringValue](ctx, c, "name", WithCodec(Protobuf))
+	assert.NoError(t, err)
+	assert.Equal(t, "facily", got.GetValue())
+
+	assert.ErrorIs(t, Set(ctx, c, "order", order{}, time.Minute, WithCodec(Protobuf)), ErrNotProtoMessage)
+	_, err = Get[order](ctx, c, "name", WithCodec(Protobuf))
+	assert.ErrorIs(t, err, ErrNotProtoMessage)
+}
+
+func TestGet_errors(t *testing.T) {
+	ctx := context.Background()
+	c := mapClient{"invalid": "{"}
+
+	_, err := Get[order](ctx, c, "absent")
+	assert.ErrorIs(t, err, ErrKeyMiss)
+
+	_, err = Get[order](ctx, c, "invalid")
+	assert.Error(t, err)
+}
@@ -2,6 +2,8 @@ package cache
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"strings"
 	"time"
 
@@ -14,12 +16,27 @@ import (
 // CachePrefix is the prefix for the environment variables.
 const CachePrefix = "CACHE_"
 
+const unlockTimeout = 5 * time.Second
+
 // ClientI is the interface for the cache.
 var _ ClientI = (*Client)(nil)
 
+var _ Locker = (*Client)(nil)
+
 // ErrKeyMiss is the error returned when the key does not exist.
 var ErrKeyMiss = errors.New("key does not exist")
 
+// ErrLocked is the error returned when the lock is held by someone else.
+var ErrLocked = errors.New("key is locked")
+
+// unlockScript deletes the lock only if it still has the token, so an expired
+// lock taken by another instance is kept.
+var unlockScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+
 // Client is the interface for the cache.
 type Client struct {
 	client redis.UniversalClient
@@ -103,3 +120,29 @@ func (r *Client) Get(ctx context.Context, key string) (string, error) {
 func (r *Client) Del(ctx context.Context, keys ...string) error {
 	return errors.Wrap(r.client.Del(ctx, keys...).Err(), "cannot delete")
 }
+
+// Lock acquires key with SET NX for ttl. Release errors are ignored as the lock
+// expires after ttl anyway.
+func (r *Client) Lock(ctx context.Context, key string, ttl time.Duration) (func(), error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, errors.Wrap(err, "cannot generate lock token")
+	}
+	token := hex.EncodeToString(b)
+
+	ok, err := r.client.SetNX(ctx, key, token, ttl).Result()
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot lock key '%s'", key)
+	}
+	if !ok {
+		return nil, errors.Wrapf(ErrLocked, "cannot lock key '%s'", key)
+	}
+
+	return func() {
+		// ctx may be done after a long load, lock must still be released.
+		ctx, cancel := context.WithTimeout(context.Background(), unlockTimeout)
+		defer cancel()
+
+		unlockScript.Run(ctx, r.client, []string{key}, token)
+	}, nil
+}
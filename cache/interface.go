@@ -11,3 +11,10 @@ type ClientI interface {
 	Get(context.Context, string) (string, error)
 	Del(context.Context, ...string) error
 }
+
+// Locker acquires locks shared between instances, used by GetOrLoad to load
+// a missing key only once. Lock returns ErrLocked if key is already locked,
+// release frees the lock, which otherwise expires after ttl.
+type Locker interface {
+	Lock(ctx context.Context, key string, ttl time.Duration) (release func(), err error)
+}
@@ -0,0 +1,278 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	lockSuffix = ":lock"
+	// defaultLockTTL is used by WithLock when ttl is not positive.
+	defaultLockTTL = 10 * time.Second
+	// defaultLoadTimeout limits loaders shared by concurrent misses, see
+	// WithLoadTimeout.
+	defaultLoadTimeout = 10 * time.Second
+)
+
+// loadMetaMagic starts values stored by GetOrLoad, followed by how long loader
+// took and when value expires, codec outputs never start with it.
+var loadMetaMagic = []byte{0x00, 'x'}
+
+const loadMetaSize = 2 + 8 + 8
+
+var (
+	// loads de-duplicates concurrent misses of a key in this instance, keys
+	// are scoped by client, see loadKey.
+	loads singleflight.Group
+	// lockPollInterval is how often GetOrLoad checks the cache while another
+	// instance holds the lock.
+	lockPollInterval = 50 * time.Millisecond
+	// randFloat returns a number in [0, 1), it only spreads refreshes so it is
+	// not cryptographic.
+	randFloat = rand.Float64 //nolint:gosec // see above.
+	// errLockExpired is returned by waitLoaded when the lock holder did not
+	// store the value within lock ttl.
+	errLockExpired = errors.New("lock expired before value was loaded")
+)
+
+// Loader loads the value of a missing key, generally from the database.
+type Loader[T any] func(ctx context.Context) (T, error)
+
+// WithLock makes GetOrLoad lock the key using locker before calling loader,
+// so only one instance loads it. Other instances wait up to ttl for the value
+// before loading it themselves, ttl should be longer than loader takes. Not
+// positive ttl defaults to 10s.
+func WithLock(locker Locker, ttl time.Duration) Option {
+	if ttl <= 0 {
+		ttl = defaultLockTTL
+	}
+
+	return func(o *options) {
+		o.locker = locker
+		o.lockTTL = ttl
+	}
+}
+
+// WithLoadTimeout limits how long GetOrLoad loader may take, default 10s.
+// Loader is shared by concurrent misses, so it does not stop when the caller
+// ctx is canceled, only after timeout.
+func WithLoadTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.loadTimeout = timeout
+	}
+}
+
+// WithEarlyRefresh sets beta of probabilistic early refresh, default 1.
+// Greater beta refreshes earlier, zero refreshes only after expiration.
+func WithEarlyRefresh(beta float64) Option {
+	return func(o *options) {
+		o.beta = beta
+	}
+}
+
+// GetOrLoad returns key from cache, on miss it calls loader and stores its
+// value for ttl. Concurrent misses in the same instance call loader once, and
+// WithLock extends it to every instance.
+//
+// Before expiration a value may be refreshed early, with increasing chance as
+// expiration approaches and when loader is slow (XFetch), so hot keys do not
+// expire at once. A failed early refresh returns the cached value.
+//
+// Cache errors only make GetOrLoad call loader, it fails only when loader
+// does. Values are readable by Get with the same options.
+func GetOrLoad[T any](ctx context.Context, c ClientI, key string, ttl time.Duration, loader Loader[T], opts ...Option) (T, error) {
+	o := newOptions(opts)
+
+	value, meta, err := get[T](ctx, c, key, o)
+	if err == nil && !meta.refreshEarly(o.beta) {
+		return value, nil
+	}
+
+	fresh, loadErr := load(ctx, c, key, ttl, loader, o)
+	if loadErr != nil && err == nil {
+		return value, nil
+	}
+
+	return fresh, loadErr
+}
+
+func load[T any](ctx context.Context, c ClientI, key string, ttl time.Duration, loader Loader[T], o options) (T, error) {
+	ch := loads.DoChan(loadKey(c, key), func() (interface{}, error) {
+		// the first caller ctx is not used, its cancellation would fail
+		// every caller waiting for the same key.
+		loadCtx, cancel := context.WithTimeout(detachedContext{ctx}, o.loadTimeout)
+		defer cancel()
+
+		return loadAndStore(loadCtx, c, key, ttl, loader, o)
+	})
+
+	var v interface{}
+	select {
+	case <-ctx.Done():
+		var value T
+
+		return value, errors.WithStack(ctx.Err())
+	case res := <-ch:
+		if res.Err != nil {
+			var value T
+
+			return value, res.Err
+		}
+		v = res.Val
+	}
+
+	if value, ok := v.(T); ok {
+		return value, nil
+	}
+
+	// another type was loaded at the same key, load it apart.
+	return loadAndStore(ctx, c, key, ttl, loader, o)
+}
+
+// loadKey scopes key to c, so clients using the same key names, like two
+// redis databases, do not share loads. Clients are told apart by pointer,
+// others by type.
+func loadKey(c ClientI, key string) string {
+	if v := reflect.ValueOf(c); v.Kind() == reflect.Pointer {
+		return strconv.FormatUint(uint64(v.Pointer()), 16) + ":" + key
+	}
+
+	return fmt.Sprintf("%T:%s", c, key)
+}
+
+// detachedContext keeps ctx values, like tracing spans, without its deadline
+// and cancellation.
+type detachedContext struct {
+	parent context.Context //nolint:containedctx // only values are used.
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (d detachedContext) Value(key any) any {
+	return d.parent.Value(key)
+}
+
+func loadAndStore[T any](ctx context.Context, c ClientI, key string, ttl time.Duration, loader Loader[T], o options) (T, error) {
+	if o.locker != nil {
+		release, err := o.locker.Lock(ctx, key+lockSuffix, o.lockTTL)
+		switch {
+		case err == nil:
+			defer release()
+		case errors.Is(err, ErrLocked):
+			value, err := waitLoaded[T](ctx, c, key, o)
+			if err == nil || !errors.Is(err, errLockExpired) {
+				return value, err
+			}
+		}
+		// without lock, like when locker fails, value is loaded anyway.
+	}
+
+	start := time.Now()
+
+	value, err := loader(ctx)
+	if err != nil {
+		return value, err
+	}
+
+	// cache failures are not returned, value is loaded again on next call.
+	if data, err := encode(key, value, o); err == nil {
+		meta := loadMeta{delta: time.Since(start), expiry: time.Time{}}
+		if ttl > 0 {
+			meta.expiry = time.Now().Add(ttl)
+		}
+		c.Set(ctx, key, string(meta.prepend(data)), ttl) //nolint:errcheck // see above.
+	}
+
+	return value, nil
+}
+
+// waitLoaded polls key until it is stored by the lock holder, returning
+// errLockExpired when lock ttl passes or ctx error when it is done.
+func waitLoaded[T any](ctx context.Context, c ClientI, key string, o options) (T, error) {
+	deadline := time.NewTimer(o.lockTTL)
+	defer deadline.Stop()
+
+	poll := time.NewTicker(lockPollInterval)
+	defer poll.Stop()
+
+	for {
+		if value, _, err := get[T](ctx, c, key, o); err == nil {
+			return value, nil
+		}
+
+		var value T
+		select {
+		case <-ctx.Done():
+			return value, errors.WithStack(ctx.Err())
+		case <-deadline.C:
+			return value, errors.WithStack(errLockExpired)
+		case <-poll.C:
+		}
+	}
+}
+
+// loadMeta is stored with values by GetOrLoad for early refresh.
+type loadMeta struct {
+	delta  time.Duration
+	expiry time.Time
+}
+
+func (m loadMeta) prepend(data []byte) []byte {
+	out := make([]byte, loadMetaSize, loadMetaSize+len(data))
+	copy(out, loadMetaMagic)
+	binary.BigEndian.PutUint64(out[2:], uint64(m.delta.Milliseconds()))
+	if !m.expiry.IsZero() {
+		binary.BigEndian.PutUint64(out[10:], uint64(m.expiry.UnixMilli()))
+	}
+
+	return append(out, data...)
+}
+
+// splitLoadMeta returns metadata stored by GetOrLoad, if any, and the value.
+func splitLoadMeta(data []byte) (loadMeta, []byte) {
+	if len(data) < loadMetaSize || !bytes.HasPrefix(data, loadMetaMagic) {
+		return loadMeta{}, data
+	}
+
+	meta := loadMeta{
+		delta:  time.Duration(binary.BigEndian.Uint64(data[2:])) * time.Millisecond,
+		expiry: time.Time{},
+	}
+	if expiry := int64(binary.BigEndian.Uint64(data[10:])); expiry > 0 {
+		meta.expiry = time.UnixMilli(expiry)
+	}
+
+	return meta, data[loadMetaSize:]
+}
+
+// refreshEarly implements XFetch, refreshing when
+// now - delta * beta * ln(rand) >= expiry.
+func (m loadMeta) refreshEarly(beta float64) bool {
+	if m.expiry.IsZero() || beta <= 0 {
+		return false
+	}
+
+	gap := time.Duration(float64(m.delta) * beta * -math.Log(1-randFloat()))
+
+	return !time.Now().Add(gap).Before(m.expiry)
+}
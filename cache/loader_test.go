@@ -0,0 +1,272 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syncClient is a ClientI safe for concurrent use.
+type syncClient struct {
+	mu sync.Mutex
+	m  mapClient
+}
+
+func newSyncClient() *syncClient {
+	return &syncClient{mu: sync.Mutex{}, m: mapClient{}}
+}
+
+func (s *syncClient) Set(ctx context.Context, key, value string, expire time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.m.Set(ctx, key, value, expire)
+}
+
+func (s *syncClient) Get(ctx context.Context, key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.m.Get(ctx, key)
+}
+
+func (s *syncClient) Del(ctx context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.m.Del(ctx, keys...)
+}
+
+// lockedLocker behaves as if another instance holds every lock.
+type lockedLocker struct{}
+
+func (lockedLocker) Lock(context.Context, string, time.Duration) (func(), error) {
+	return nil, ErrLocked
+}
+
+func countingLoader(calls *int32, value order, err error) Loader[order] {
+	return func(context.Context) (order, error) {
+		atomic.AddInt32(calls, 1)
+
+		return value, err
+	}
+}
+
+func TestGetOrLoad(t *testing.T) {
+	ctx := context.Background()
+	want := order{ID: 7, Items: []string{"sku"}}
+
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "json", opts: nil},
+		{name: "msgpack compressed", opts: []Option{WithCodec(Msgpack), WithCompression(0)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newSyncClient()
+
+			var calls int32
+			for i := 0; i < 3; i++ {
+				got, err := GetOrLoad(ctx, c, "order:7", time.Hour, countingLoader(&calls, want, nil), tt.opts...)
+				require.NoError(t, err)
+				assert.Equal(t, want, got)
+			}
+			assert.Equal(t, int32(1), calls)
+
+			got, err := Get[order](ctx, c, "order:7", tt.opts...)
+			require.NoError(t, err)
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+func TestGetOrLoad_loaderError(t *testing.T) {
+	c := newSyncClient()
+	errDB := errors.New("db down")
+
+	var calls int32
+	_, err := GetOrLoad(context.Background(), c, "order:7", time.Hour, countingLoader(&calls, order{}, errDB))
+	assert.ErrorIs(t, err, errDB)
+
+	_, err = c.Get(context.Background(), "order:7")
+	assert.ErrorIs(t, err, ErrKeyMiss)
+}
+
+func TestGetOrLoad_concurrentMisses(t *testing.T) {
+	c := newSyncClient()
+	release := make(chan struct{})
+
+	var calls int32
+	loader := func(context.Context) (order, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+
+		return order{ID: 7, Items: nil}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			got, err := GetOrLoad(context.Background(), c, "order:7", time.Hour, loader)
+			assert.NoError(t, err)
+			assert.Equal(t, 7, got.ID)
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls)
+}
+
+func TestGetOrLoad_clientsDoNotShareLoads(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	go func() {
+		_, _ = GetOrLoad(context.Background(), newSyncClient(), "order:7", time.Hour, func(context.Context) (order, error) {
+			close(started)
+			<-release
+
+			return order{ID: 1, Items: nil}, nil
+		})
+	}()
+	<-started
+	defer close(release)
+
+	var calls int32
+	got, err := GetOrLoad(context.Background(), newSyncClient(), "order:7", time.Hour,
+		countingLoader(&calls, order{ID: 2, Items: nil}, nil))
+	require.NoError(t, err)
+	assert.Equal(t, 2, got.ID)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestGetOrLoad_canceledCaller(t *testing.T) {
+	c := newSyncClient()
+	started, release := make(chan struct{}), make(chan struct{})
+	loader := func(ctx context.Context) (order, error) {
+		close(started)
+		<-release
+
+		return order{ID: 7, Items: nil}, ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := GetOrLoad(ctx, c, "order:7", time.Hour, loader)
+		done <- err
+	}()
+	<-started
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	// the shared load is not canceled with its first caller.
+	close(release)
+	assert.Eventually(t, func() bool {
+		got, err := Get[order](context.Background(), c, "order:7")
+
+		return err == nil && got.ID == 7
+	}, time.Second, time.Millisecond)
+}
+
+func TestGetOrLoad_earlyRefresh(t *testing.T) {
+	ctx := context.Background()
+	cached := order{ID: 1, Items: nil}
+	fresh := order{ID: 2, Items: nil}
+	errDB := errors.New("db down")
+
+	tests := []struct {
+		name      string
+		rand      float64
+		beta      float64
+		loaderErr error
+		want      order
+	}{
+		{name: "far from expiry", rand: 0, beta: 1, want: cached},
+		{name: "refreshed early", rand: 1 - 1e-12, beta: 1, want: fresh},
+		{name: "disabled", rand: 1 - 1e-12, beta: 0, want: cached},
+		{name: "failed refresh returns cached", rand: 1 - 1e-12, beta: 1, loaderErr: errDB, want: cached},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defaultRand := randFloat
+			randFloat = func() float64 { return tt.rand }
+			defer func() { randFloat = defaultRand }()
+
+			c := newSyncClient()
+			data, err := encode("order:7", cached, newOptions(nil))
+			require.NoError(t, err)
+			meta := loadMeta{delta: time.Minute, expiry: time.Now().Add(10 * time.Minute)}
+			require.NoError(t, c.Set(ctx, "order:7", string(meta.prepend(data)), time.Hour))
+
+			var calls int32
+			got, err := GetOrLoad(ctx, c, "order:7", time.Hour, countingLoader(&calls, fresh, tt.loaderErr),
+				WithEarlyRefresh(tt.beta))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestGetOrLoad_lock(t *testing.T) {
+	ctx := context.Background()
+	want := order{ID: 7, Items: nil}
+
+	lockPollInterval = time.Millisecond
+	defer func() { lockPollInterval = 50 * time.Millisecond }()
+
+	tests := []struct {
+		name      string
+		stored    bool
+		wantCalls int32
+	}{
+		{name: "waits value loaded by lock holder", stored: true, wantCalls: 0},
+		{name: "loads after lock ttl", stored: false, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newSyncClient()
+			if tt.stored {
+				time.AfterFunc(10*time.Millisecond, func() {
+					assert.NoError(t, Set(ctx, c, "order:7", want, time.Hour))
+				})
+			}
+
+			var calls int32
+			got, err := GetOrLoad(ctx, c, "order:7", time.Hour, countingLoader(&calls, want, nil),
+				WithLock(lockedLocker{}, 100*time.Millisecond))
+			require.NoError(t, err)
+			assert.Equal(t, want, got)
+			assert.Equal(t, tt.wantCalls, atomic.LoadInt32(&calls))
+		})
+	}
+}
+
+func TestGetOrLoad_lockWaitTimeout(t *testing.T) {
+	var calls int32
+	_, err := GetOrLoad(context.Background(), newSyncClient(), "order:7", time.Hour,
+		countingLoader(&calls, order{ID: 7, Items: nil}, nil),
+		WithLock(lockedLocker{}, time.Hour), WithLoadTimeout(20*time.Millisecond))
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+}
+
+func TestWithLock_defaultTTL(t *testing.T) {
+	for _, ttl := range []time.Duration{0, -time.Second} {
+		o := newOptions([]Option{WithLock(lockedLocker{}, ttl)})
+		assert.Equal(t, defaultLockTTL, o.lockTTL)
+	}
+}
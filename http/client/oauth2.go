@@ -0,0 +1,115 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+const defaultRefreshBefore = 30 * time.Second
+
+// ErrNoTokenURL is the error returned by requests when neither TokenURL nor
+// Provider is given to WithClientCredentials.
+var ErrNoTokenURL = errors.New("token url cannot be empty")
+
+// TokenEndpointProvider returns the provider oauth2 endpoints, *auth.OIDC
+// satisfies it.
+type TokenEndpointProvider interface {
+	Endpoint() oauth2.Endpoint
+}
+
+// ClientCredentials configures WithClientCredentials.
+type ClientCredentials struct {
+	// ClientID and ClientSecret of the calling service.
+	ClientID     string
+	ClientSecret string
+	// TokenURL of the provider, if empty it is discovered from Provider.
+	TokenURL string
+	// Provider used to discover TokenURL, like *auth.OIDC.
+	Provider TokenEndpointProvider
+	// Scopes requested, optional.
+	Scopes []string
+	// EndpointParams are extra token request parameters, like audience.
+	EndpointParams url.Values
+	// RefreshBefore is how long before expiry a new token is requested,
+	// default 30s.
+	RefreshBefore time.Duration
+	// HTTPClient sends token requests, default http.DefaultTransport with the
+	// client timeout. The client transport is not used, so the secret and
+	// tokens are not logged by WithLogger.
+	HTTPClient *http.Client
+}
+
+// WithClientCredentials makes the client obtain tokens using the oauth2 client
+// credentials grant and send them as "Authorization: Bearer" on every
+// request. Tokens are cached and shared by every request of the client,
+// requested again shortly before they expire.
+//
+// Apply it before WithLogger, so logged requests do not have the token yet,
+// the header is set on a copy of the request after it is logged.
+func WithClientCredentials(cc ClientCredentials) func(*http.Client) {
+	return func(c *http.Client) {
+		base := c.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+
+		tokenClient := cc.HTTPClient
+		if tokenClient == nil {
+			tokenClient = &http.Client{
+				Transport:     http.DefaultTransport,
+				CheckRedirect: nil,
+				Jar:           nil,
+				Timeout:       c.Timeout,
+			}
+		}
+
+		c.Transport = &oauth2.Transport{
+			Source: cc.tokenSource(tokenClient),
+			Base:   base,
+		}
+	}
+}
+
+// tokenSource returns a cached oauth2.TokenSource requesting tokens with
+// client.
+func (cc ClientCredentials) tokenSource(client *http.Client) oauth2.TokenSource {
+	tokenURL := cc.TokenURL
+	if tokenURL == "" && cc.Provider != nil {
+		tokenURL = cc.Provider.Endpoint().TokenURL
+	}
+	if tokenURL == "" {
+		return errTokenSource{errors.WithStack(ErrNoTokenURL)}
+	}
+
+	refreshBefore := cc.RefreshBefore
+	if refreshBefore == 0 {
+		refreshBefore = defaultRefreshBefore
+	}
+
+	config := &clientcredentials.Config{
+		ClientID:       cc.ClientID,
+		ClientSecret:   cc.ClientSecret,
+		TokenURL:       tokenURL,
+		Scopes:         cc.Scopes,
+		EndpointParams: cc.EndpointParams,
+		AuthStyle:      oauth2.AuthStyleAutoDetect,
+	}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, client)
+
+	return oauth2.ReuseTokenSourceWithExpiry(nil, config.TokenSource(ctx), refreshBefore)
+}
+
+// errTokenSource fails every token request with err.
+type errTokenSource struct {
+	err error
+}
+
+func (s errTokenSource) Token() (*oauth2.Token, error) {
+	return nil, s.err
+}
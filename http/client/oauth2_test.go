@@ -0,0 +1,165 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/facily-tech/go-core/log"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+type fakeProvider struct {
+	tokenURL string
+}
+
+func (p fakeProvider) Endpoint() oauth2.Endpoint {
+	return oauth2.Endpoint{AuthURL: "", TokenURL: p.tokenURL, AuthStyle: oauth2.AuthStyleAutoDetect}
+}
+
+func newTokenServer(t *testing.T, expiresIn int) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+
+		id, secret, ok := r.BasicAuth()
+		assert.NoError(t, r.ParseForm())
+		if !ok || id != "sellers-backend" || secret != "s3cr3t" || r.PostForm.Get("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		assert.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "token-" + string(rune('0'+n)),
+			"token_type":   "Bearer",
+			"expires_in":   expiresIn,
+		}))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &calls
+}
+
+func TestWithClientCredentials(t *testing.T) {
+	tests := []struct {
+		name       string
+		expiresIn  int
+		wantTokens []string
+	}{
+		{name: "token is reused", expiresIn: 3600, wantTokens: []string{"Bearer token-1", "Bearer token-1"}},
+		{name: "token about to expire is refreshed", expiresIn: 10, wantTokens: []string{"Bearer token-1", "Bearer token-2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenSrv, _ := newTokenServer(t, tt.expiresIn)
+
+			var got []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = append(got, r.Header.Get("Authorization"))
+			}))
+			defer srv.Close()
+
+			c := &http.Client{
+				Transport:     nil,
+				CheckRedirect: nil,
+				Jar:           nil,
+				Timeout:       0,
+			}
+			WithClientCredentials(ClientCredentials{
+				ClientID:     "sellers-backend",
+				ClientSecret: "s3cr3t",
+				Provider:     fakeProvider{tokenURL: tokenSrv.URL},
+			})(c)
+
+			for range tt.wantTokens {
+				req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, srv.URL, nil)
+				assert.NoError(t, err)
+
+				resp, err := c.Do(req)
+				assert.NoError(t, err)
+				closeHelper(t, resp.Body)
+			}
+
+			assert.Equal(t, tt.wantTokens, got)
+		})
+	}
+}
+
+func TestWithClientCredentials_logger(t *testing.T) {
+	tokenSrv, _ := newTokenServer(t, 3600)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token-1", r.Header.Get("Authorization"))
+	}))
+	defer srv.Close()
+
+	// only the api request is logged, without token.
+	logMock := log.NewMockLogger(gomock.NewController(t))
+	logMock.EXPECT().Info(gomock.Any(), "http request", gomock.Any()).Times(1).
+		Do(func(_ context.Context, _ string, fields ...log.Field) {
+			dump, _ := fields[0].Value.(string)
+			assert.NotContains(t, dump, "Authorization")
+		})
+
+	c := &http.Client{
+		Transport:     nil,
+		CheckRedirect: nil,
+		Jar:           nil,
+		Timeout:       0,
+	}
+	WithClientCredentials(ClientCredentials{
+		ClientID:     "sellers-backend",
+		ClientSecret: "s3cr3t",
+		TokenURL:     tokenSrv.URL,
+	})(c)
+	WithLogger(c, logMock, []string{"2.."})
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, srv.URL, nil)
+	assert.NoError(t, err)
+
+	resp, err := c.Do(req)
+	assert.NoError(t, err)
+	closeHelper(t, resp.Body)
+}
+
+func TestWithClientCredentials_errors(t *testing.T) {
+	tokenSrv, _ := newTokenServer(t, 3600)
+
+	tests := []struct {
+		name string
+		cc   ClientCredentials
+		want error
+	}{
+		{name: "no token url", cc: ClientCredentials{ClientID: "sellers-backend", ClientSecret: "s3cr3t"}, want: ErrNoTokenURL},
+		{name: "wrong secret", cc: ClientCredentials{ClientID: "sellers-backend", ClientSecret: "wrong", TokenURL: tokenSrv.URL}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &http.Client{
+				Transport:     nil,
+				CheckRedirect: nil,
+				Jar:           nil,
+				Timeout:       0,
+			}
+			WithClientCredentials(tt.cc)(c)
+
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, tokenSrv.URL, nil)
+			assert.NoError(t, err)
+
+			resp, err := c.Do(req) //nolint:bodyclose // no response on error.
+			assert.Nil(t, resp)
+			assert.Error(t, err)
+			if tt.want != nil {
+				assert.ErrorIs(t, err, tt.want)
+			}
+		})
+	}
+}
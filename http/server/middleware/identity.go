@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidCustomerID is the error returned when mobile token customer id is
+// missing or not an integer.
+var ErrInvalidCustomerID = errors.New("customer id must be an integer")
+
+// Identity values set by JWTMW or by JWTClaimsMW extractors.
+var (
+	CustomerIDKey = NewContextKey[string]("customerID")
+	TenantIDKey   = NewContextKey[string]("tenantID")
+	DeviceIDKey   = NewContextKey[string]("deviceID")
+)
+
+// ContextKey stores and retrieves values of type T from a context. Keys are
+// unique even if created with the same name.
+type ContextKey[T any] struct {
+	name string
+}
+
+// NewContextKey creates a ContextKey, name is only used for debugging.
+func NewContextKey[T any](name string) *ContextKey[T] {
+	return &ContextKey[T]{name: name}
+}
+
+// Set returns a new context using ctx as parent and inserting v.
+func (k *ContextKey[T]) Set(ctx context.Context, v T) context.Context {
+	return context.WithValue(ctx, k, v)
+}
+
+// Get retrieves value from ctx, false if absent.
+func (k *ContextKey[T]) Get(ctx context.Context) (T, bool) {
+	v, ok := ctx.Value(k).(T)
+
+	return v, ok
+}
+
+// String returns key name.
+func (k *ContextKey[T]) String() string {
+	return k.name
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextKey(t *testing.T) {
+	key := NewContextKey[int64]("attempts")
+	other := NewContextKey[int64]("attempts")
+
+	ctx := key.Set(context.Background(), 3)
+
+	got, ok := key.Get(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), got)
+
+	_, ok = other.Get(ctx)
+	assert.False(t, ok, "keys with same name must not collide")
+
+	_, ok = key.Get(context.Background())
+	assert.False(t, ok)
+	assert.Equal(t, "attempts", key.String())
+}
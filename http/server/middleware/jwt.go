@@ -5,13 +5,18 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/facily-tech/go-core/log"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/pkg/errors"
 )
 
 const (
-	bearerPrefix = "Bearer "
+	bearerPrefix    = "Bearer "
+	msgInvalidToken = `{"message": "token isn't valid"}`
+	msgNoKeys       = `{"message": "token cannot be validated"}`
 )
 
 var (
@@ -20,10 +25,35 @@ var (
 
 type customerIDContextKey string
 
-// JWTConfig contains the requirements to validate a jwt token.
+// JWTConfig contains the requirements to validate a jwt token. HMAC tokens
+// are verified with Secret, RS256, ES256, EdDSA and other asymmetric ones with
+// PublicKeyFiles or KeySet keys, selected by token kid. At least one of them
+// is required.
 type JWTConfig struct {
-	Secret string `env:"JWT_SECRET,required"`
+	Secret string `env:"JWT_SECRET"`
 	Issuer string `env:"JWT_ISSUER,default=https://faci.ly"`
+	// Audience, if set, must be present at token aud claim.
+	Audience string `env:"JWT_AUDIENCE"`
+	// Leeway tolerates clock skew validating exp, nbf and iat claims.
+	Leeway time.Duration `env:"JWT_LEEWAY,default=0s"`
+	// PublicKeyFiles are PEM public keys, the kid of each key is its file name
+	// without extension, like "2023-06" for "/keys/2023-06.pem". Keep the old
+	// and the new key while rotating.
+	PublicKeyFiles []string `env:"JWT_PUBLIC_KEY_FILES"`
+	// KeySet, if set, provides keys not found at PublicKeyFiles, like an
+	// auth.KeySet loading a JSON Web Key Set URL.
+	KeySet KeySet
+	// Revocation, if set, rejects tokens revoked before expiration, checked
+	// after signature verification. auth.Denylist satisfies it.
+	Revocation RevocationChecker
+	// Logger, if set, logs keys JWTMW cannot load.
+	Logger log.Logger
+}
+
+// RevocationChecker tells if a verified token was revoked, by its jti, sid or
+// subject, empty arguments are unknown.
+type RevocationChecker interface {
+	Revoked(ctx context.Context, jti, sid, sub string, issuedAt time.Time) (bool, error)
 }
 
 type mobileClaim struct {
@@ -35,59 +65,153 @@ type mobileClaim struct {
 	jwt.RegisteredClaims
 }
 
+// claimsPointer constrains C to be *T implementing jwt.Claims, so a new T is
+// created for each token.
+type claimsPointer[T any] interface {
+	*T
+	jwt.Claims
+}
+
+// Extractor places values from token claims into ctx, like CustomerIDKey,
+// TenantIDKey or DeviceIDKey. Returning an error rejects the token.
+type Extractor[C jwt.Claims] func(ctx context.Context, claims C) (context.Context, error)
+
 // JWTMW middleware checks for jwt token and if present validate and populate
-// with custom claim ID. ID can be retrieved using GetCustomerID.
+// with custom claim ID. ID can be retrieved using GetCustomerID. Keys are
+// loaded when JWTMW is called, if they cannot be the error is logged, requests
+// fail with 500 and keys are loaded again on the next request. Use Middleware
+// to stop at startup instead.
 func (j JWTConfig) JWTMW(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		encodedToken := getToken(r.Header.Get("authorization"))
-		if encodedToken == "" {
-			http.Error(w, "missing authorization token", http.StatusUnauthorized)
+	mw, err := j.Middleware()
+	if err == nil {
+		return mw(next)
+	}
+	j.logKeysError(context.Background(), err)
+
+	return &retryKeysHandler{config: j, next: next, mu: sync.Mutex{}, handler: nil}
+}
+
+func (j JWTConfig) logKeysError(ctx context.Context, err error) {
+	if j.Logger != nil {
+		j.Logger.Error(ctx, "jwt: cannot load keys, tokens cannot be validated", log.Error(err))
+	}
+}
+
+// retryKeysHandler loads keys on each request until they are loaded, so
+// temporary failures, like a key file not mounted yet, are not kept.
+type retryKeysHandler struct {
+	config JWTConfig
+	next   http.Handler
+
+	mu      sync.Mutex
+	handler http.Handler
+}
+
+func (h *retryKeysHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	if h.handler == nil {
+		mw, err := h.config.Middleware()
+		if err != nil {
+			h.mu.Unlock()
+			h.config.logKeysError(r.Context(), err)
+			http.Error(w, msgNoKeys, http.StatusInternalServerError)
 
 			return
 		}
+		h.handler = mw(h.next)
+	}
+	handler := h.handler
+	h.mu.Unlock()
 
-		token, err := jwt.ParseWithClaims(encodedToken, &mobileClaim{}, func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrTokenSignatureInvalid
-			}
+	handler.ServeHTTP(w, r)
+}
 
-			iss, err := t.Claims.GetIssuer()
-			if err != nil {
-				return nil, errors.WithStack(err)
+// Middleware returns JWTMW, loading keys before.
+func (j JWTConfig) Middleware() (func(next http.Handler) http.Handler, error) {
+	return JWTClaimsMW(j, extractMobile)
+}
+
+// JWTClaimsMW is like JWTMW, but token claims are parsed into a new T, e.g.
+// jwt.MapClaims or a struct embedding jwt.RegisteredClaims, and extract
+// places identity values from them into the request context.
+//
+//	mw, err := middleware.JWTClaimsMW(config, func(ctx context.Context, c *partnerClaims) (context.Context, error) {
+//		return middleware.TenantIDKey.Set(ctx, c.Tenant), nil
+//	})
+func JWTClaimsMW[T any, C claimsPointer[T]](
+	j JWTConfig,
+	extract Extractor[C],
+) (func(next http.Handler) http.Handler, error) {
+	keys, err := newJWTKeys(j)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(keys.methods()),
+		jwt.WithIssuer(j.Issuer),
+		jwt.WithLeeway(j.Leeway),
+	}
+	if j.Audience != "" {
+		opts = append(opts, jwt.WithAudience(j.Audience))
+	}
+	parser := jwt.NewParser(opts...)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encodedToken := getToken(r.Header.Get("authorization"))
+			if encodedToken == "" {
+				http.Error(w, "missing authorization token", http.StatusUnauthorized)
+
+				return
 			}
-			if iss != j.Issuer {
-				return nil, jwt.ErrTokenInvalidIssuer
+
+			claims := C(new(T))
+			token, err := parser.ParseWithClaims(encodedToken, claims, keys.keyfunc(r.Context()))
+			if err == nil {
+				err = checkRevocation(r.Context(), j.Revocation, parser, token)
 			}
+			if err != nil {
+				// validation details are not sent, they may expose internals.
+				http.Error(w, msgInvalidToken, http.StatusUnauthorized)
 
-			return []byte(j.Secret), nil
-		})
-		if err != nil {
-			http.Error(w, `{"message": "token isn't valid: `+err.Error()+`"}`, http.StatusUnauthorized)
+				return
+			}
 
-			return
-		}
+			ctx, err := extract(r.Context(), claims)
+			if err != nil {
+				http.Error(w, `{"message": "token claims aren't valid"}`, http.StatusUnauthorized)
 
-		claims, ok := token.Claims.(*mobileClaim)
-		if !ok {
-			w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
 
-			return
-		}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}, nil
+}
 
-		customerID, err := strconv.ParseInt(claims.Data.User.ID, 10, 64)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+// extractMobile sets customer id from mobile tokens data.user.id, tokens
+// without it are rejected. Use JWTClaimsMW to take it from other claims, like
+// sub.
+func extractMobile(ctx context.Context, claims *mobileClaim) (context.Context, error) {
+	id := claims.Data.User.ID
+	if id == "" {
+		return nil, errors.Wrap(ErrInvalidCustomerID, "token without data.user.id")
+	}
 
-			return
-		}
+	customerID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidCustomerID, id)
+	}
 
-		r = r.WithContext(SetCustomerID(r.Context(), int(customerID)))
+	ctx = CustomerIDKey.Set(ctx, id)
 
-		next.ServeHTTP(w, r)
-	})
+	return SetCustomerID(ctx, int(customerID)), nil
 }
 
 // GetCustomerID retrieve id from ctx. Return -1 of type assertion fail.
+//
+// Deprecated: use CustomerIDKey.Get, ids are not always integers.
 func GetCustomerID(ctx context.Context) int {
 	id, ok := ctx.Value(customerIDContextKey("customerID")).(int)
 	if !ok {
@@ -2,11 +2,28 @@ package middleware
 
 import (
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/facily-tech/go-core/log"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 //nolint:bodyclose // false positive, body is bytes.Buffer
@@ -101,3 +118,326 @@ func TestGetCustomerID(t *testing.T) {
 		})
 	}
 }
+
+type jwtTestKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.Signer
+}
+
+func newJWTTestKeys(t *testing.T) (rsaKey, ecKey, edKey jwtTestKey) {
+	t.Helper()
+
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecPrivate, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	return jwtTestKey{kid: "rsa", method: jwt.SigningMethodRS256, private: rsaPrivate},
+		jwtTestKey{kid: "ec", method: jwt.SigningMethodES256, private: ecPrivate},
+		jwtTestKey{kid: "ed", method: jwt.SigningMethodEdDSA, private: edPrivate}
+}
+
+func (k jwtTestKey) sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(k.method, claims)
+	token.Header["kid"] = k.kid
+	signed, err := token.SignedString(k.private)
+	require.NoError(t, err)
+
+	return signed
+}
+
+func (k jwtTestKey) pemFile(t *testing.T, dir string) string {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(k.private.Public())
+	require.NoError(t, err)
+
+	file := filepath.Join(dir, k.kid+".pem")
+	require.NoError(t, os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600))
+
+	return file
+}
+
+// fakeKeySet is a KeySet of keys by kid, like auth.KeySet after a refresh.
+type fakeKeySet struct {
+	mu   sync.Mutex
+	keys map[string]crypto.PublicKey
+}
+
+func (f *fakeKeySet) add(k jwtTestKey) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.keys[k.kid] = k.private.Public()
+}
+
+func (f *fakeKeySet) PublicKey(_ context.Context, kid string) (crypto.PublicKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if key, ok := f.keys[kid]; ok {
+		return key, nil
+	}
+
+	return nil, errors.New("unknown kid")
+}
+
+func validClaims(id string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":  "https://faci.ly",
+		"aud":  "sellers",
+		"data": map[string]interface{}{"user": map[string]interface{}{"id": id}},
+		"exp":  time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestJWTConfig_Middleware_asymmetric(t *testing.T) {
+	rsaKey, ecKey, edKey := newJWTTestKeys(t)
+	dir := t.TempDir()
+
+	keySet := &fakeKeySet{mu: sync.Mutex{}, keys: map[string]crypto.PublicKey{}}
+	keySet.add(ecKey)
+
+	mw, err := JWTConfig{
+		Secret:         "fake secret",
+		Issuer:         "https://faci.ly",
+		Audience:       "sellers",
+		Leeway:         time.Minute,
+		PublicKeyFiles: []string{rsaKey.pemFile(t, dir)},
+		KeySet:         keySet,
+	}.Middleware()
+	require.NoError(t, err)
+
+	// edKey is published after middleware creation, like a key rotation.
+	keySet.add(edKey)
+
+	rsaPublic, err := x509.MarshalPKIXPublicKey(rsaKey.private.Public())
+	require.NoError(t, err)
+	hmacWithPublicKey := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims("1"))
+	hmacWithPublicKey.Header["kid"] = rsaKey.kid
+	confused, err := hmacWithPublicKey.SignedString(rsaPublic)
+	require.NoError(t, err)
+
+	expiredInLeeway := validClaims("5")
+	expiredInLeeway["exp"] = time.Now().Add(-30 * time.Second).Unix()
+	expired := validClaims("5")
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	otherAudience := validClaims("5")
+	otherAudience["aud"] = "other"
+	unknownKid := rsaKey
+	unknownKid.kid = "unknown"
+
+	tests := []struct {
+		name   string
+		token  string
+		want   int
+		wantID int
+	}{
+		{name: "RS256 from pem file", token: rsaKey.sign(t, validClaims("1")), want: http.StatusOK, wantID: 1},
+		{name: "ES256 from key set", token: ecKey.sign(t, validClaims("2")), want: http.StatusOK, wantID: 2},
+		{name: "EdDSA from rotated key set", token: edKey.sign(t, validClaims("3")), want: http.StatusOK, wantID: 3},
+		{name: "expired within leeway", token: rsaKey.sign(t, expiredInLeeway), want: http.StatusOK, wantID: 5},
+		{name: "expired", token: rsaKey.sign(t, expired), want: http.StatusUnauthorized},
+		{name: "other audience", token: rsaKey.sign(t, otherAudience), want: http.StatusUnauthorized},
+		{name: "unknown kid", token: unknownKid.sign(t, validClaims("1")), want: http.StatusUnauthorized},
+		{name: "HS256 signed with public key", token: confused, want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Add("authorization", "Bearer "+tt.token)
+
+			mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, tt.wantID, GetCustomerID(r.Context()))
+			})).ServeHTTP(w, r)
+
+			assert.Equal(t, tt.want, w.Code, w.Body.String())
+			if tt.want == http.StatusUnauthorized {
+				assert.Equal(t, msgInvalidToken+"\n", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestJWTConfig_Middleware_errors(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(notPEM, []byte("not a key"), 0o600))
+
+	tests := []struct {
+		name   string
+		config JWTConfig
+		want   error
+	}{
+		{name: "no keys", config: JWTConfig{Issuer: "https://faci.ly"}, want: ErrNoJWTKeys},
+		{name: "invalid pem", config: JWTConfig{PublicKeyFiles: []string{notPEM}}, want: ErrInvalidPEM},
+		{name: "missing file", config: JWTConfig{PublicKeyFiles: []string{filepath.Join(dir, "absent.pem")}}, want: os.ErrNotExist},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.config.Middleware()
+			assert.ErrorIs(t, err, tt.want)
+
+			logger := log.NewMockLogger(gomock.NewController(t))
+			logger.EXPECT().Error(gomock.Any(), "jwt: cannot load keys, tokens cannot be validated", gomock.Any()).Times(2)
+			tt.config.Logger = logger
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Add("authorization", "Bearer token")
+			tt.config.JWTMW(http.NotFoundHandler()).ServeHTTP(w, r)
+			assert.Equal(t, http.StatusInternalServerError, w.Code)
+		})
+	}
+}
+
+func TestJWTConfig_JWTMW_keysRetried(t *testing.T) {
+	rsaKey, _, _ := newJWTTestKeys(t)
+	dir := t.TempDir()
+	file := filepath.Join(dir, rsaKey.kid+".pem")
+
+	logger := log.NewMockLogger(gomock.NewController(t))
+	logger.EXPECT().Error(gomock.Any(), gomock.Any(), gomock.Any()).Times(2)
+	config := JWTConfig{Issuer: "https://faci.ly", PublicKeyFiles: []string{file}, Logger: logger}
+	handler := config.JWTMW(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func() int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Add("authorization", "Bearer "+rsaKey.sign(t, validClaims("1")))
+		handler.ServeHTTP(w, r)
+
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusInternalServerError, serve())
+
+	// key file mounted after start.
+	assert.Equal(t, file, rsaKey.pemFile(t, dir))
+	assert.Equal(t, http.StatusOK, serve())
+}
+
+func TestJWTConfig_Middleware_noSecret(t *testing.T) {
+	rsaKey, _, _ := newJWTTestKeys(t)
+
+	mw, err := JWTConfig{Issuer: "https://faci.ly", PublicKeyFiles: []string{rsaKey.pemFile(t, t.TempDir())}}.
+		Middleware()
+	require.NoError(t, err)
+
+	hmac, err := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims("1")).SignedString([]byte(""))
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Add("authorization", "Bearer "+hmac)
+
+	mw(http.NotFoundHandler()).ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+type partnerClaims struct {
+	Tenant string `json:"tenant"`
+	Device string `json:"device"`
+	jwt.RegisteredClaims
+}
+
+func TestJWTClaimsMW(t *testing.T) {
+	config := JWTConfig{Secret: "fake secret", Issuer: "https://faci.ly"}
+
+	mw, err := JWTClaimsMW(config, func(ctx context.Context, c *partnerClaims) (context.Context, error) {
+		if c.Tenant == "" {
+			return nil, errors.New("tenant required")
+		}
+		ctx = TenantIDKey.Set(ctx, c.Tenant)
+
+		return DeviceIDKey.Set(ctx, c.Device), nil
+	})
+	require.NoError(t, err)
+
+	sign := func(claims jwt.MapClaims) string {
+		claims["iss"] = "https://faci.ly"
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("fake secret"))
+		require.NoError(t, err)
+
+		return signed
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		want       int
+		wantTenant string
+		wantDevice string
+	}{
+		{
+			name:       "identity extracted",
+			token:      sign(jwt.MapClaims{"tenant": "facily", "device": "ios-123"}),
+			want:       http.StatusOK,
+			wantTenant: "facily",
+			wantDevice: "ios-123",
+		},
+		{name: "extractor error", token: sign(jwt.MapClaims{"device": "ios-123"}), want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Add("authorization", "Bearer "+tt.token)
+
+			mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tenant, _ := TenantIDKey.Get(r.Context())
+				device, _ := DeviceIDKey.Get(r.Context())
+				assert.Equal(t, tt.wantTenant, tenant)
+				assert.Equal(t, tt.wantDevice, device)
+			})).ServeHTTP(w, r)
+
+			assert.Equal(t, tt.want, w.Code, w.Body.String())
+		})
+	}
+}
+
+func TestJWTConfig_JWTMW_customerID(t *testing.T) {
+	config := JWTConfig{Secret: "fake secret", Issuer: "https://faci.ly"}
+
+	sign := func(claims jwt.MapClaims) string {
+		claims["iss"] = "https://faci.ly"
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("fake secret"))
+		require.NoError(t, err)
+
+		return signed
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		want   int
+		wantID string
+	}{
+		{name: "mobile token", token: sign(jwt.MapClaims{"data": map[string]interface{}{"user": map[string]interface{}{"id": "42"}}}), want: http.StatusOK, wantID: "42"},
+		{name: "sub is not used", token: sign(jwt.MapClaims{"sub": "43"}), want: http.StatusUnauthorized},
+		{name: "no id", token: sign(jwt.MapClaims{}), want: http.StatusUnauthorized},
+		{name: "id not integer", token: sign(jwt.MapClaims{"data": map[string]interface{}{"user": map[string]interface{}{"id": "abc"}}}), want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Add("authorization", "Bearer "+tt.token)
+
+			config.JWTMW(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				id, ok := CustomerIDKey.Get(r.Context())
+				assert.Equal(t, tt.wantID != "", ok)
+				assert.Equal(t, tt.wantID, id)
+			})).ServeHTTP(w, r)
+
+			assert.Equal(t, tt.want, w.Code, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNoJWTKeys is the error returned when JWTConfig has neither a secret
+	// nor public keys.
+	ErrNoJWTKeys = errors.New("jwt secret, public keys or key set required")
+	// ErrUnknownKeyID is the error returned when no key matches token kid.
+	ErrUnknownKeyID = errors.New("no key matches token kid")
+	// ErrInvalidPEM is the error returned when a public key file is not PEM.
+	ErrInvalidPEM = errors.New("invalid pem public key")
+)
+
+// KeySet provides public keys by token kid, empty kid means the token has
+// none. auth.KeySet satisfies it, fetching and refreshing keys from a JSON Web
+// Key Set URL.
+type KeySet interface {
+	PublicKey(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+// jwtKeys selects the key verifying a token, HMAC tokens use secret while
+// asymmetric ones use the key with the same kid, from files or key set.
+type jwtKeys struct {
+	secret []byte
+	static map[string]crypto.PublicKey
+	keySet KeySet
+}
+
+func newJWTKeys(j JWTConfig) (*jwtKeys, error) {
+	k := &jwtKeys{
+		secret: nil,
+		static: map[string]crypto.PublicKey{},
+		keySet: j.KeySet,
+	}
+	if j.Secret != "" {
+		k.secret = []byte(j.Secret)
+	}
+
+	for _, file := range j.PublicKeyFiles {
+		key, err := readPublicKey(file)
+		if err != nil {
+			return nil, err
+		}
+		k.static[strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))] = key
+	}
+
+	if k.secret == nil && len(k.static) == 0 && k.keySet == nil {
+		return nil, errors.WithStack(ErrNoJWTKeys)
+	}
+
+	return k, nil
+}
+
+// methods returns the signing algorithms accepted, HMAC only if secret is
+// set and asymmetric ones only if public keys are.
+func (k *jwtKeys) methods() []string {
+	var methods []string
+	if k.secret != nil {
+		methods = append(methods, "HS256", "HS384", "HS512")
+	}
+	if len(k.static) > 0 || k.keySet != nil {
+		methods = append(methods,
+			"RS256", "RS384", "RS512", "PS256", "PS384", "PS512",
+			"ES256", "ES384", "ES512", "EdDSA",
+		)
+	}
+
+	return methods
+}
+
+// keyfunc returns a jwt.Keyfunc, ctx is used to fetch keys from key set.
+func (k *jwtKeys) keyfunc(ctx context.Context) jwt.Keyfunc {
+	return func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); ok {
+			if k.secret == nil {
+				return nil, jwt.ErrTokenSignatureInvalid
+			}
+
+			return k.secret, nil
+		}
+
+		kid, ok := t.Header["kid"].(string)
+		if !ok || kid == "" {
+			// without kid any key of the token algorithm may be used, only
+			// unambiguous when there is a single one.
+			return k.anyKey(ctx, t.Method)
+		}
+
+		if key, ok := k.static[kid]; ok {
+			return key, nil
+		}
+		if k.keySet != nil {
+			key, err := k.keySet.PublicKey(ctx, kid)
+
+			return key, errors.Wrapf(err, "kid %q", kid)
+		}
+
+		return nil, errors.Wrapf(ErrUnknownKeyID, "kid %q", kid)
+	}
+}
+
+func (k *jwtKeys) anyKey(ctx context.Context, method jwt.SigningMethod) (crypto.PublicKey, error) {
+	keys := make([]crypto.PublicKey, 0, len(k.static)+1)
+	for _, key := range k.static {
+		keys = append(keys, key)
+	}
+	if k.keySet != nil {
+		if key, err := k.keySet.PublicKey(ctx, ""); err == nil {
+			keys = append(keys, key)
+		}
+	}
+
+	var found crypto.PublicKey
+	for _, key := range keys {
+		if !keyMatches(method, key) {
+			continue
+		}
+		if found != nil {
+			return nil, errors.Wrap(ErrUnknownKeyID, "token without kid and many keys")
+		}
+		found = key
+	}
+	if found == nil {
+		return nil, errors.Wrap(ErrUnknownKeyID, "token without kid")
+	}
+
+	return found, nil
+}
+
+func keyMatches(method jwt.SigningMethod, key crypto.PublicKey) bool {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		_, rsaOK := method.(*jwt.SigningMethodRSA)
+		_, pssOK := method.(*jwt.SigningMethodRSAPSS)
+
+		return rsaOK || pssOK
+	case *ecdsa.PublicKey:
+		_, ok := method.(*jwt.SigningMethodECDSA)
+
+		return ok
+	case ed25519.PublicKey:
+		_, ok := method.(*jwt.SigningMethodEd25519)
+
+		return ok
+	}
+
+	return false
+}
+
+// readPublicKey reads a PEM encoded PKIX or PKCS1 public key.
+func readPublicKey(file string) (crypto.PublicKey, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read public key")
+	}
+
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.Wrap(ErrInvalidPEM, file)
+	}
+
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+		return cert.PublicKey, nil
+	}
+
+	return nil, errors.Wrap(ErrInvalidPEM, file)
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+)
+
+// ErrRevokedToken is the error returned when token was revoked before its
+// expiration.
+var ErrRevokedToken = errors.New("token revoked")
+
+// revocationClaims are the claims used to check revocation, parsed apart
+// because callers claims type may not have them.
+type revocationClaims struct {
+	ID        string           `json:"jti"`
+	SessionID string           `json:"sid"`
+	Subject   string           `json:"sub"`
+	IssuedAt  *jwt.NumericDate `json:"iat"`
+}
+
+// checkRevocation returns ErrRevokedToken if verified token is revoked at
+// checker, nil checker allows every token.
+func checkRevocation(ctx context.Context, checker RevocationChecker, parser *jwt.Parser, token *jwt.Token) error {
+	if checker == nil {
+		return nil
+	}
+
+	parts := strings.Split(token.Raw, ".")
+	if len(parts) != 3 {
+		return errors.WithStack(jwt.ErrTokenMalformed)
+	}
+	payload, err := parser.DecodeSegment(parts[1])
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var claims revocationClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return errors.WithStack(err)
+	}
+
+	var issuedAt time.Time
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+
+	revoked, err := checker.Revoked(ctx, claims.ID, claims.SessionID, claims.Subject, issuedAt)
+	if err != nil {
+		return errors.Wrap(err, "cannot check revocation")
+	}
+	if revoked {
+		return errors.WithStack(ErrRevokedToken)
+	}
+
+	return nil
+}
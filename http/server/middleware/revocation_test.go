@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRevocation struct {
+	revoked map[string]bool
+	err     error
+}
+
+func (f fakeRevocation) Revoked(_ context.Context, jti, sid, sub string, issuedAt time.Time) (bool, error) {
+	if issuedAt.IsZero() {
+		return false, errors.New("iat expected")
+	}
+
+	return f.revoked[jti] || f.revoked[sid] || f.revoked[sub], f.err
+}
+
+func TestJWTConfig_Revocation(t *testing.T) {
+	sign := func(claims jwt.MapClaims) string {
+		claims["iss"] = "https://faci.ly"
+		claims["iat"] = time.Now().Unix()
+		claims["data"] = map[string]interface{}{"user": map[string]interface{}{"id": "42"}}
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("fake secret"))
+		require.NoError(t, err)
+
+		return signed
+	}
+
+	tests := []struct {
+		name       string
+		revocation fakeRevocation
+		token      string
+		want       int
+	}{
+		{name: "not revoked", revocation: fakeRevocation{}, token: sign(jwt.MapClaims{"jti": "1", "sub": "42"}), want: http.StatusOK},
+		{
+			name:       "revoked jti",
+			revocation: fakeRevocation{revoked: map[string]bool{"1": true}},
+			token:      sign(jwt.MapClaims{"jti": "1", "sub": "42"}),
+			want:       http.StatusUnauthorized,
+		},
+		{
+			name:       "revoked session",
+			revocation: fakeRevocation{revoked: map[string]bool{"device-1": true}},
+			token:      sign(jwt.MapClaims{"sid": "device-1", "sub": "42"}),
+			want:       http.StatusUnauthorized,
+		},
+		{
+			name:       "checker failure",
+			revocation: fakeRevocation{err: errors.New("connection refused")},
+			token:      sign(jwt.MapClaims{"sub": "42"}),
+			want:       http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := JWTConfig{Secret: "fake secret", Issuer: "https://faci.ly", Revocation: tt.revocation}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Add("authorization", "Bearer "+tt.token)
+
+			config.JWTMW(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+
+			assert.Equal(t, tt.want, w.Code, w.Body.String())
+		})
+	}
+}